@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/grezar/go-circleci"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditRecord is a change of a variable recorded in the audit log
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	// User is the login of the owner of the API token. It is empty if it cannot be fetched.
+	User string `json:"user" yaml:"user"`
+	// Project is the project slug. It is empty for the variables of contexts.
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+	// Context is the context name for the variables of contexts
+	Context   string `json:"context,omitempty" yaml:"context,omitempty"`
+	Operation string `json:"operation" yaml:"operation"`
+	Name      string `json:"name" yaml:"name"`
+	// Value is the new value masked in the same way as CircleCI. It is empty for deletions.
+	Value  string `json:"value,omitempty" yaml:"value,omitempty"`
+	Result string `json:"result" yaml:"result"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// AuditLogPath returns the path of the audit log
+func AuditLogPath() string {
+	return xdg.StateHome + "/ccienv/audit.jsonl"
+}
+
+// auditLogger appends the changes made by a client to the audit log
+// A nil logger records nothing
+type auditLogger struct {
+	path string
+	ci   *circleci.Client
+
+	once sync.Once
+	user string
+}
+
+func newAuditLogger(path string, ci *circleci.Client) *auditLogger {
+	if path == "" {
+		return nil
+	}
+	return &auditLogger{path: path, ci: ci}
+}
+
+// currentUser fetches the login of the user only once
+func (a *auditLogger) currentUser(ctx context.Context) string {
+	a.once.Do(func() {
+		u, err := currentUser(ctx, a.ci)
+		if err != nil {
+			logrus.WithField("error", err).Debug("Failed to get the user for the audit log")
+			return
+		}
+		a.user = u.Login
+	})
+	return a.user
+}
+
+// recordOperations records the results of ops for the project or the context
+// The planned results of dry run are not recorded since nothing is changed.
+func (a *auditLogger) recordOperations(ctx context.Context, project string, contextName string, ops []*operation, rs []*ResultRecord) {
+	if a == nil {
+		return
+	}
+	entries := make([]*AuditRecord, 0, len(ops))
+	for i, op := range ops {
+		if rs[i].Result == ResultPlanned {
+			continue
+		}
+		entries = append(entries, a.entry(ctx, project, contextName, op.kind, op.name, op.value, rs[i]))
+	}
+	a.append(entries)
+}
+
+// recordResult records the result of a single change of a project variable
+func (a *auditLogger) recordResult(ctx context.Context, project string, kind string, name string, value string, r *ResultRecord) {
+	if a == nil || r.Result == ResultPlanned {
+		return
+	}
+	a.append([]*AuditRecord{a.entry(ctx, project, "", kind, name, value, r)})
+}
+
+func (a *auditLogger) entry(ctx context.Context, project string, contextName string, kind string, name string, value string, r *ResultRecord) *AuditRecord {
+	e := &AuditRecord{
+		Timestamp: time.Now(),
+		User:      a.currentUser(ctx),
+		Project:   project,
+		Context:   contextName,
+		Operation: kind,
+		Name:      name,
+		Result:    r.Result,
+		Error:     r.Error,
+	}
+	if kind == "create" {
+		e.Value = maskValue(value)
+	}
+	return e
+}
+
+// append writes entries at the end of the audit log
+// Failures are only logged so that they do not affect the changes which are already made
+func (a *auditLogger) append(entries []*AuditRecord) {
+	if len(entries) == 0 {
+		return
+	}
+	if err := appendAuditRecords(a.path, entries); err != nil {
+		logrus.WithField("error", err).Warn("Failed to write the audit log.")
+	}
+}
+
+func appendAuditRecords(path string, entries []*AuditRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("append audit records: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("append audit records: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		bt, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("append audit records: %w", err)
+		}
+		w.Write(bt)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("append audit records: %w", err)
+	}
+	return nil
+}
+
+// AuditFilter selects records of the audit log. Empty fields match any records.
+type AuditFilter struct {
+	Project string
+	Context string
+	Name    string
+	// Since is the inclusive lower bound of the timestamps
+	Since time.Time
+	// Until is the exclusive upper bound of the timestamps
+	Until time.Time
+}
+
+func (f *AuditFilter) match(r *AuditRecord) bool {
+	switch {
+	case f.Project != "" && r.Project != f.Project:
+		return false
+	case f.Context != "" && r.Context != f.Context:
+		return false
+	case f.Name != "" && r.Name != f.Name:
+		return false
+	case !f.Since.IsZero() && r.Timestamp.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.Timestamp.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// ReadAuditLog reads the records matching f from the audit log in the order they were recorded
+// No records are returned if the audit log does not exist
+func ReadAuditLog(path string, f AuditFilter) ([]*AuditRecord, error) {
+	rs := make([]*AuditRecord, 0)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	defer file.Close()
+
+	scn := bufio.NewScanner(file)
+	scn.Buffer(nil, 1024*1024)
+	for line := 1; scn.Scan(); line++ {
+		if len(scn.Bytes()) == 0 {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(scn.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("read audit log: line %d: %w", line, err)
+		}
+		if f.match(&r) {
+			rs = append(rs, &r)
+		}
+	}
+	if err := scn.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return rs, nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ccienv", "audit.jsonl")
+	day := func(d int) time.Time { return time.Date(2023, 5, d, 12, 0, 0, 0, time.UTC) }
+	records := []*AuditRecord{
+		{Timestamp: day(1), User: "octocat", Project: "gh/org/a", Operation: "create", Name: "FOO", Value: "xxxx_new", Result: ResultSucceeded},
+		{Timestamp: day(2), User: "octocat", Project: "gh/org/b", Operation: "delete", Name: "FOO", Result: ResultFailed, Error: "boom"},
+		{Timestamp: day(3), User: "octocat", Context: "shared", Operation: "create", Name: "BAR", Value: "xxxx_bar", Result: ResultSucceeded},
+	}
+	if err := appendAuditRecords(path, records[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendAuditRecords(path, records[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []*AuditRecord
+	}{
+		{"all", AuditFilter{}, records},
+		{"project", AuditFilter{Project: "gh/org/a"}, records[:1]},
+		{"context", AuditFilter{Context: "shared"}, records[2:]},
+		{"name", AuditFilter{Name: "FOO"}, records[:2]},
+		{"period", AuditFilter{Since: day(2), Until: day(3)}, records[1:2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadAuditLog(path, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, got, len(tt.want))
+			for i := range got {
+				assert.True(t, tt.want[i].Timestamp.Equal(got[i].Timestamp))
+				got[i].Timestamp = tt.want[i].Timestamp
+				assert.Equal(t, tt.want[i], got[i])
+			}
+		})
+	}
+
+	got, err := ReadAuditLog(filepath.Join(t.TempDir(), "none.jsonl"), AuditFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+
+	if err := os.WriteFile(path, []byte("{}\nbroken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadAuditLog(path, AuditFilter{})
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestAuditLogger_recordOperations(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v2/me",
+		httpmock.NewStringResponder(200, `{"id":"uid","login":"octocat","name":"The Octocat"}`))
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a := newAuditLogger(path, ci)
+	ops := []*operation{
+		{kind: "create", name: "FOO", value: "secret-value"},
+		{kind: "delete", name: "BAR"},
+		{kind: "create", name: "BAZ", value: "planned"},
+	}
+	rs := []*ResultRecord{
+		newResultRecord("FOO", "create", nil),
+		newResultRecord("BAR", "delete", nil),
+		{Name: "BAZ", Operation: "create", Result: ResultPlanned},
+	}
+	a.recordOperations(context.Background(), projectSlug, "", ops, rs)
+	a.recordOperations(context.Background(), projectSlug, "", ops[:1], rs[:1])
+
+	got, err := ReadAuditLog(path, AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, got, 3, "planned results are not recorded")
+	assert.Equal(t, "octocat", got[0].User)
+	assert.Equal(t, projectSlug, got[0].Project)
+	assert.Equal(t, "xxxxalue", got[0].Value, "only the last 4 characters are recorded")
+	assert.Equal(t, "", got[1].Value)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET https://circleci.com/api/v2/me"], "the user is fetched only once")
+
+	var nilLogger *auditLogger
+	nilLogger.recordOperations(context.Background(), projectSlug, "", ops, rs)
+}
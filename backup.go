@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"filippo.io/age"
+	"github.com/grezar/go-circleci"
+)
+
+// backupVersion is the version of the format of backup archives
+const backupVersion = 1
+
+// backupWorkFactor is the scrypt work factor of the passphrase. It is the same as the default of age.
+var backupWorkFactor = 18
+
+// backupArchive is the content of a backup file before encryption
+type backupArchive struct {
+	Version   int               `json:"version"`
+	Project   string            `json:"project"`
+	CreatedAt time.Time         `json:"created_at"`
+	Variables []*backupVariable `json:"variables"`
+}
+
+type backupVariable struct {
+	Name string `json:"name"`
+	// MaskedValue is the value returned by CircleCI. (e.g. `xxxx1234`)
+	MaskedValue string `json:"masked_value"`
+	// Value is the plaintext value. It is nil if the value is not found in the source.
+	Value *string `json:"value,omitempty"`
+}
+
+// readPassphrase returns passphrase or reads it by prompts if it is empty
+// The passphrase is asked twice when confirm is true
+func readPassphrase(ui UI, passphrase string, confirm bool) (string, error) {
+	if passphrase != "" {
+		return passphrase, nil
+	}
+	p, err := ui.ReadSecret("Please input the passphrase of the backup: ")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("the passphrase is empty")
+	}
+	if confirm {
+		again, err := ui.ReadSecret("Please input the passphrase again: ")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", errors.New("the passphrases do not match")
+		}
+	}
+	return p, nil
+}
+
+func encryptArchive(a *backupArchive, passphrase string) ([]byte, error) {
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(backupWorkFactor)
+	bt, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(bt); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decryptArchive(data []byte, passphrase string) (*backupArchive, error) {
+	id, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), id)
+	if err != nil {
+		return nil, err
+	}
+	bt, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var a backupArchive
+	if err := json.Unmarshal(bt, &a); err != nil {
+		return nil, err
+	}
+	if a.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version: %d", a.Version)
+	}
+	return &a, nil
+}
+
+// BackupVariables writes the variables of the project into an encrypted file
+// The masked values are always saved. The plaintext values are also saved if they are found in a file (if srcPath is not empty).
+// The passphrase is read by prompts if it is empty.
+func (c *Client) BackupVariables(ctx context.Context, outPath string, srcPath string, filetype string, passphrase string) ([]*ResultRecord, error) {
+	vs, err := c.listAllVariables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("backup vars: %w", err)
+	}
+	known := make(map[string]*circleci.ProjectVariable)
+	if srcPath != "" {
+		lvs, err := readVariables(c.ui, c.opts.AgeKeyFile, srcPath, filetype)
+		if err != nil {
+			return nil, fmt.Errorf("backup vars: %w", err)
+		}
+		known = makeProjectVariableMap(lvs)
+	}
+
+	a := &backupArchive{
+		Version:   backupVersion,
+		Project:   c.projectSlug,
+		CreatedAt: time.Now(),
+		Variables: make([]*backupVariable, len(vs)),
+	}
+	masked := make([]string, 0)
+	for i, v := range vs {
+		bv := &backupVariable{Name: v.Name, MaskedValue: v.Value}
+		if lv, prs := known[v.Name]; prs {
+			val := lv.Value
+			bv.Value = &val
+		} else {
+			masked = append(masked, v.Name)
+		}
+		a.Variables[i] = bv
+	}
+	if srcPath != "" {
+		dumpNames(c.info(), "The plaintext values of these variables are not found and only the masked values are saved.", masked)
+	}
+
+	passphrase, err = readPassphrase(c.ui, passphrase, true)
+	if err != nil {
+		return nil, fmt.Errorf("backup vars: %w", err)
+	}
+	data, err := encryptArchive(a, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("backup vars: %w", err)
+	}
+	if err := os.WriteFile(outPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("backup vars: %w", err)
+	}
+	c.printf("Saved %d variables of %s to %s\n", len(vs), c.projectSlug, outPath)
+
+	rs := make([]*ResultRecord, len(vs))
+	for i, v := range vs {
+		rs[i] = newResultRecord(v.Name, "backup", nil)
+	}
+	return rs, nil
+}
+
+// RestoreVariables recreates the variables in a backup file which are missing in the project
+// Variables whose plaintext values are not in the backup are skipped since they cannot be recreated.
+// ErrCancelled is returned if the user cancelled
+func (c *Client) RestoreVariables(ctx context.Context, path string, passphrase string) ([]*ResultRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("restore vars: %w", err)
+	}
+	passphrase, err = readPassphrase(c.ui, passphrase, false)
+	if err != nil {
+		return nil, fmt.Errorf("restore vars: %w", err)
+	}
+	a, err := decryptArchive(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("restore vars: %w", err)
+	}
+	if a.Project != c.projectSlug {
+		c.printf("The backup was taken from %s.\n", a.Project)
+	}
+
+	vs, err := c.listAllVariables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("restore vars: %w", err)
+	}
+	existing := makeProjectVariableMap(vs)
+	restores := make([]*circleci.ProjectVariable, 0)
+	noValues := make([]string, 0)
+	for _, bv := range a.Variables {
+		if _, prs := existing[bv.Name]; prs {
+			continue
+		}
+		if bv.Value == nil {
+			noValues = append(noValues, bv.Name)
+			continue
+		}
+		restores = append(restores, &circleci.ProjectVariable{Name: bv.Name, Value: *bv.Value})
+	}
+
+	dumpNames(c.info(), "These variables are missing but have no plaintext values in the backup. They are skipped.", noValues)
+	skipped := make([]*ResultRecord, len(noValues))
+	for i, n := range noValues {
+		skipped[i] = &ResultRecord{Name: n, Operation: "create", Result: ResultSkipped, Error: "no plaintext value in the backup"}
+	}
+	if len(restores) == 0 {
+		c.println("There are no variables to be restored.")
+		return skipped, nil
+	}
+
+	c.printf("These variables will be restored from the backup at %s.\n", a.CreatedAt.Format(time.RFC3339))
+	c.println()
+	dumpVariables(c.info(), maskVariables(restores))
+	c.println()
+	yes, err := c.ui.YesNo("Do you want to restore these variables?")
+	if err != nil {
+		return nil, fmt.Errorf("restore vars: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+
+	rs, err := c.updateOrCreateVariables(ctx, restores)
+	if rs == nil {
+		return nil, err
+	}
+	return append(rs, skipped...), err
+}
+
+// maskVariables returns copies of pvs whose values are masked for previews
+func maskVariables(pvs []*circleci.ProjectVariable) []*circleci.ProjectVariable {
+	res := make([]*circleci.ProjectVariable, len(pvs))
+	for i, pv := range pvs {
+		res[i] = &circleci.ProjectVariable{Name: pv.Name, Value: maskValue(pv.Value)}
+	}
+	return res
+}
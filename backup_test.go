@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+func init() {
+	// Keep the tests fast
+	backupWorkFactor = 10
+}
+
+func Test_encryptArchive(t *testing.T) {
+	val := "aaa"
+	a := &backupArchive{
+		Version: backupVersion,
+		Project: projectSlug,
+		Variables: []*backupVariable{
+			{Name: "TEST_ENV_1", MaskedValue: "xxxxaaa", Value: &val},
+			{Name: "TEST_ENV_3", MaskedValue: "xxxxccc"},
+		},
+	}
+	data, err := encryptArchive(a, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, string(data), "TEST_ENV_1", "the archive is encrypted")
+
+	got, err := decryptArchive(data, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a, got)
+
+	_, err = decryptArchive(data, "wrong")
+	assert.Error(t, err)
+}
+
+func TestClient_BackupAndRestoreVariables(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	listURL := apiBaseURL + "/envvar"
+	createURL := apiBaseURL + "/envvar"
+	before, err := httpmock.NewJsonResponder(200, circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "TEST_ENV_1", Value: "xxxxaaa"},
+			{Name: "TEST_ENV_2", Value: "xxxxbbb"},
+			{Name: "TEST_ENV_3", Value: "xxxxccc"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", listURL, before)
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	c := &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		ui:          ui,
+		token:       testAPIToken,
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.age")
+	ui.EXPECT().ReadSecret(gomock.Any()).Return("passphrase", nil).Times(2)
+	rs, err := c.BackupVariables(context.Background(), path, "fixtures/dotenv.test", "dotenv", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rs, 3)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// TEST_ENV_1 and TEST_ENV_3 are removed after the backup
+	after, err := httpmock.NewJsonResponder(200, circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "TEST_ENV_2", Value: "xxxxbbb"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", listURL, after)
+	var created []string
+	httpmock.RegisterResponder("POST", createURL, func(req *http.Request) (*http.Response, error) {
+		var pv circleci.ProjectVariable
+		if err := json.NewDecoder(req.Body).Decode(&pv); err != nil {
+			return nil, err
+		}
+		created = append(created, pv.Name+"="+pv.Value)
+		return httpmock.NewJsonResponse(201, pv)
+	})
+
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+	rs, err = c.RestoreVariables(context.Background(), path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"TEST_ENV_1=aaa"}, created)
+	assert.Equal(t, []*ResultRecord{
+		{Name: "TEST_ENV_1", Operation: "create", Result: ResultSucceeded},
+		{Name: "TEST_ENV_3", Operation: "create", Result: ResultSkipped, Error: "no plaintext value in the backup"},
+	}, rs)
+}
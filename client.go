@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,7 +10,6 @@ import (
 	"os"
 
 	"github.com/grezar/go-circleci"
-	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,29 +22,76 @@ type UI interface {
 	ReadAll(msg string) (string, error)
 }
 
+// Options changes how clients deal with confirmations and messages
+type Options struct {
+	// AssumeYes answers yes to all the confirmations without prompts
+	AssumeYes bool
+	// NoOverwrite skips variables which already exist instead of asking whether to overwrite them
+	NoOverwrite bool
+	// Messages receives progress messages and previews of confirmations. If nil, they are discarded.
+	Messages io.Writer
+	// EchoInput writes the variables read from stdin back to Messages.
+	// It should be false if the messages can be recorded since the values are written in plaintext.
+	EchoInput bool
+	// MaxAttempts is the number of attempts of an API call on 429 and 5xx responses. DefaultMaxAttempts is used if it is not positive.
+	MaxAttempts int
+	// Concurrency is the number of API calls sent at once in bulk operations. DefaultConcurrency is used if it is not positive.
+	Concurrency int
+	// DryRun skips the write calls and reports them as planned results. Confirmations are answered yes.
+	DryRun bool
+	// AuditLog is the path of the audit log where the changes of variables are recorded. Nothing is recorded if it is empty.
+	AuditLog string
+	// AgeKeyFile is the path of the age identities to decrypt age and sops inputs.
+	// SOPS_AGE_KEY_FILE or the default path of sops is used if it is empty.
+	AgeKeyFile string
+}
+
 type Client struct {
 	ci          *circleci.Client
 	projectSlug string
 	ui          UI
+	opts        Options
+	reporter
+	audit *auditLogger
 
 	token string
+	// baseURL is the URL of the API v2 for raw requests. apiV2URL is used if it is empty.
+	baseURL string
+	// httpClient is used for raw requests. http.DefaultClient is used if it is nil.
+	httpClient *http.Client
 }
 
-func NewClient(cfg *Config, prj string) (*Client, error) {
-	config := circleci.DefaultConfig()
-	config.Token = cfg.ApiToken
-	ci, err := circleci.NewClient(config)
+func NewClient(cfg *Config, prj string, opts Options) (*Client, error) {
+	ci, hc, err := newCircleCIClient(cfg, opts.MaxAttempts)
 	if err != nil {
 		return nil, fmt.Errorf("new client: %w", err)
 	}
 	return &Client{
 		ci:          ci,
 		projectSlug: prj,
-		ui:          &Prompt{},
+		ui:          newUI(opts),
+		opts:        opts,
+		reporter:    newReporter(opts.Messages),
+		audit:       newAuditLogger(opts.AuditLog, ci),
 		token:       cfg.ApiToken,
+		baseURL:     cfg.apiURL(),
+		httpClient:  hc,
 	}, nil
 }
 
+// ProjectSlug returns the slug of the target project
+func (c *Client) ProjectSlug() string {
+	return c.projectSlug
+}
+
+// ForProject returns a client for another project with the same settings
+// The clients share the HTTP client, so that all of them wait on a rate limit (429) of one of them.
+func (c *Client) ForProject(prj string) *Client {
+	cc := *c
+	cc.projectSlug = prj
+	return &cc
+}
+
 func getMaxNameLength(pv []*circleci.ProjectVariable) int {
 	maxlen := 0
 	for _, v := range pv {
@@ -55,10 +102,10 @@ func getMaxNameLength(pv []*circleci.ProjectVariable) int {
 	return maxlen
 }
 
-func dumpVariables(pv []*circleci.ProjectVariable) {
+func dumpVariables(w io.Writer, pv []*circleci.ProjectVariable) {
 	maxlen := getMaxNameLength(pv)
 	for _, v := range pv {
-		fmt.Printf("%-*s %s\n", maxlen, v.Name, v.Value)
+		fmt.Fprintf(w, "%-*s %s\n", maxlen, v.Name, v.Value)
 	}
 }
 
@@ -90,33 +137,41 @@ func getFoundAndNotFoundVariables(vars []string, items []*circleci.ProjectVariab
 	return in, out
 }
 
-func (c *Client) deleteVariables(ctx context.Context, dels []*circleci.ProjectVariable) error {
+func (c *Client) deleteVariables(ctx context.Context, dels []*circleci.ProjectVariable) ([]*ResultRecord, error) {
 	if len(dels) == 0 {
-		return fmt.Errorf("no values are specified")
+		return nil, fmt.Errorf("no values are specified")
 	}
 
-	fmt.Println("These variables will be removed.")
-	fmt.Println()
-	dumpVariables(dels)
-	fmt.Println()
+	c.println("These variables will be removed.")
+	c.println()
+	dumpVariables(c.info(), dels)
+	c.println()
 
 	yes, err := c.ui.YesNo("Do you want to continue?")
 	if err != nil {
-		return fmt.Errorf("delete vars: %w", err)
+		return nil, fmt.Errorf("delete vars: %w", err)
 	}
 	if !yes {
-		fmt.Println("Cancelled.")
-		return nil
+		c.println("Cancelled.")
+		return nil, ErrCancelled
 	}
 
-	for _, v := range dels {
-		if err := c.ci.Projects.DeleteVariable(ctx, c.projectSlug, v.Name); err != nil {
-			logrus.WithField("key", v).Errorf("Failed to delete: %v\n", err)
-		} else {
-			fmt.Printf("Deleted: %s\n", v.Name)
-		}
-	}
-	return nil
+	rs := c.removeVariables(ctx, dels)
+	return rs, checkResults(rs)
+}
+
+// removeVariables deletes each variable concurrently and continues even if some of them fail
+func (c *Client) removeVariables(ctx context.Context, dels []*circleci.ProjectVariable) []*ResultRecord {
+	ops := make([]*operation, len(dels))
+	for i, v := range dels {
+		name := v.Name
+		ops[i] = &operation{kind: "delete", name: name, call: func(ctx context.Context) error {
+			return c.ci.Projects.DeleteVariable(ctx, c.projectSlug, name)
+		}}
+	}
+	rs := executeOperations(ctx, c.opts, &c.reporter, ops)
+	c.audit.recordOperations(ctx, c.projectSlug, "", ops, rs)
+	return rs
 }
 
 func makeReverseResolutionMap(vs []string) map[string]int {
@@ -128,15 +183,17 @@ func makeReverseResolutionMap(vs []string) map[string]int {
 	return mp
 }
 
-func (c *Client) DeleteVariablesInteractive(ctx context.Context) error {
+// DeleteVariablesInteractive deletes variables chosen by prompts
+// ErrCancelled is returned if the user cancelled
+func (c *Client) DeleteVariablesInteractive(ctx context.Context) ([]*ResultRecord, error) {
 	vs, err := c.listAllVariables(ctx)
 	if err != nil {
-		return fmt.Errorf("delete vars: %w", err)
+		return nil, fmt.Errorf("delete vars: %w", err)
 	}
 	spv := convertToString(vs)
 	sel, err := c.ui.SelectFromList("Choose variables to be deleted.", spv)
 	if err != nil {
-		return fmt.Errorf("delete vars: %w", err)
+		return nil, fmt.Errorf("delete vars: %w", err)
 	}
 
 	rrm := makeReverseResolutionMap(spv)
@@ -148,109 +205,83 @@ func (c *Client) DeleteVariablesInteractive(ctx context.Context) error {
 	return c.deleteVariables(ctx, dels)
 }
 
-func (c *Client) DeleteVariables(ctx context.Context, vars []string) error {
+// DeleteVariables deletes variables by names
+// Variables not found are reported as skipped results
+func (c *Client) DeleteVariables(ctx context.Context, vars []string) ([]*ResultRecord, error) {
 	vs, err := c.listAllVariables(ctx)
 	if err != nil {
-		return fmt.Errorf("delete vars: %w", err)
+		return nil, fmt.Errorf("delete vars: %w", err)
 	}
 
 	dels, nonDels := getFoundAndNotFoundVariables(vars, vs)
 	if len(nonDels) > 0 {
-		fmt.Println("These variables are not found.")
+		c.println("These variables are not found.")
 		for _, v := range nonDels {
-			fmt.Println("  " + v)
+			c.println("  " + v)
 		}
-		fmt.Println()
+		c.println()
 	}
+	skipped := notFoundRecords(nonDels, "delete")
 	if len(dels) == 0 {
-		fmt.Println("There are no deleted variables.")
-		return nil
+		c.println("There are no deleted variables.")
+		return skipped, nil
 	}
-	return c.deleteVariables(ctx, dels)
-}
-
-type FileType uint16
-
-const (
-	FileTypeUnknown FileType = iota
-	FileTypeJson
-	FileTypeDotenv
-)
-
-func validateFormatSpecification(filetype string) (FileType, error) {
-	allowed := map[string]FileType{
-		"json":   FileTypeJson,
-		"dotenv": FileTypeDotenv,
-		"":       FileTypeDotenv, // Default value
-	}
-	if t, ok := allowed[filetype]; ok {
-		return t, nil
-	} else {
-		return FileTypeUnknown, fmt.Errorf("")
+	rs, err := c.deleteVariables(ctx, dels)
+	if rs == nil {
+		return nil, err
 	}
+	return append(rs, skipped...), err
 }
 
-func parseJsonToVariables(body string) ([]*circleci.ProjectVariable, error) {
-	// TODO: use an original type of ProjectVariable
-	var pvs []*circleci.ProjectVariable
-	if err := json.Unmarshal([]byte(body), &pvs); err != nil {
-		return nil, fmt.Errorf("parse json to variables: %w", err)
+func notFoundRecords(names []string, operation string) []*ResultRecord {
+	rs := make([]*ResultRecord, len(names))
+	for i, n := range names {
+		rs[i] = &ResultRecord{Name: n, Operation: operation, Result: ResultSkipped, Error: "not found"}
 	}
-	return pvs, nil
+	return rs
 }
 
-func parseDotenvToVariables(body string) ([]*circleci.ProjectVariable, error) {
-	env, err := godotenv.Unmarshal(body)
+// UpdateOrCreateVariablesFromFile updates environmental variables by reading a file or stdin
+// If the path is empty, stdin will be used as input
+func (c *Client) UpdateOrCreateVariablesFromFile(ctx context.Context, path string, filetype string) ([]*ResultRecord, error) {
+	pvs, err := readVariables(c.ui, c.opts.AgeKeyFile, path, filetype)
 	if err != nil {
 		return nil, err
 	}
-	pvs := make([]*circleci.ProjectVariable, len(env))
-	i := 0
-	for k, v := range env {
-		pvs[i] = &circleci.ProjectVariable{
-			Name:  k,
-			Value: v,
-		}
-		i++
-	}
-	return pvs, nil
-}
-
-func parseVariables(body string, ft FileType) ([]*circleci.ProjectVariable, error) { // TODO: use original variable type
-	switch ft {
-	case FileTypeDotenv:
-		return parseDotenvToVariables(body)
-	case FileTypeJson:
-		return parseJsonToVariables(body)
-	}
-	return nil, fmt.Errorf("no valid file type is specified at parseVariables: %v", ft)
+	return c.updateOrCreateVariables(ctx, pvs)
 }
 
-// UpdateOrCreateVariablesFromFile updates environmental variables by reading a file or stdin
+// readVariables reads variables from a file or stdin
 // If the path is empty, stdin will be used as input
-func (c *Client) UpdateOrCreateVariablesFromFile(ctx context.Context, path string, filetype string) (err error) {
+// If filetype is empty, the format is detected from the extension of the path or the content.
+// Encrypted inputs are decrypted in memory with the age identities in keyFile
+func readVariables(ui UI, keyFile string, path string, filetype string) ([]*circleci.ProjectVariable, error) {
 	ft, err := validateFormatSpecification(filetype)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	body := ""
 	if path == "" {
-		body, err = c.ui.ReadAll("Please input environment variables. (Finish to send EOF)")
+		body, err = ui.ReadAll("Please input environment variables. (Finish to send EOF)")
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		dat, err := os.ReadFile(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		body = string(dat)
 	}
-	pvs, err := parseVariables(body, ft)
-	if err != nil {
-		return err
+	if ft == FileTypeUnknown {
+		ft = detectFileType(path, body)
+		logrus.WithFields(logrus.Fields{"path": path, "type": ft}).Debug("Detected the file type")
 	}
-	return c.updateOrCreateVariables(ctx, pvs)
+	pvs, err := parseVariables(body, ft, keyFile)
+	if err != nil && path != "" {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pvs, err
 }
 
 func makeProjectVariableMap(vs []*circleci.ProjectVariable) map[string]*circleci.ProjectVariable {
@@ -261,127 +292,220 @@ func makeProjectVariableMap(vs []*circleci.ProjectVariable) map[string]*circleci
 	return mp
 }
 
-func (c *Client) updateOrCreateVariables(ctx context.Context, pvs []*circleci.ProjectVariable) error {
-	vs, err := c.listAllVariables(ctx)
+func (c *Client) updateOrCreateVariables(ctx context.Context, pvs []*circleci.ProjectVariable) ([]*ResultRecord, error) {
+	pvs, yes, err := c.confirmOverwrite(ctx, pvs)
 	if err != nil {
-		return fmt.Errorf("update or create: %w", err)
+		return nil, fmt.Errorf("update or create: %w", err)
 	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+	rs := c.createVariables(ctx, pvs)
+	return rs, checkResults(rs)
+}
+
+// splitByExistence splits pvs into the variables which exist in vs and the others
+func splitByExistence(pvs []*circleci.ProjectVariable, vs []*circleci.ProjectVariable) ([]*circleci.ProjectVariable, []*circleci.ProjectVariable) {
 	mp := makeProjectVariableMap(vs)
-	overwrittens := make([]*circleci.ProjectVariable, 0)
+	exists := make([]*circleci.ProjectVariable, 0)
+	news := make([]*circleci.ProjectVariable, 0)
 	for _, pv := range pvs {
 		if v, prs := mp[pv.Name]; prs {
-			overwrittens = append(overwrittens, v)
+			exists = append(exists, v)
+		} else {
+			news = append(news, pv)
 		}
 	}
-	if len(overwrittens) > 0 {
-		fmt.Println("These values are already exist.")
-		fmt.Println()
-		dumpVariables(overwrittens)
-		fmt.Println()
-		yes, err := c.ui.YesNo("Do you want to update all the variables?")
-		if err != nil {
-			return err
-		}
-		if !yes {
-			fmt.Println("Cancelled.")
-			return nil
-		}
+	return exists, news
+}
+
+func dumpSkippedVariables(w io.Writer, skipped []*circleci.ProjectVariable) {
+	fmt.Fprintln(w, "These values already exist and are skipped.")
+	fmt.Fprintln(w)
+	dumpVariables(w, skipped)
+	fmt.Fprintln(w)
+}
+
+// confirmOverwrite asks the user whether existing variables can be overwritten by pvs
+// It returns the variables to be written and false if the user cancelled
+// With the NoOverwrite option, existing variables are excluded without asking
+func (c *Client) confirmOverwrite(ctx context.Context, pvs []*circleci.ProjectVariable) ([]*circleci.ProjectVariable, bool, error) {
+	vs, err := c.listAllVariables(ctx)
+	if err != nil {
+		return nil, false, err
 	}
-	for _, pv := range pvs {
-		v, err := c.ci.Projects.CreateVariable(ctx, c.projectSlug, circleci.ProjectCreateVariableOptions{
-			Name:  &pv.Name,
-			Value: &pv.Value,
-		})
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"key":   pv.Name,
-				"error": err,
-			}).Error("An error occured when creating a variable. Continue.")
-		} else {
-			fmt.Printf("Created: %v\n", v.Name)
-		}
+	overwrittens, news := splitByExistence(pvs, vs)
+	if len(overwrittens) == 0 {
+		return pvs, true, nil
 	}
-	return nil
+	if c.opts.NoOverwrite {
+		dumpSkippedVariables(c.info(), overwrittens)
+		return news, true, nil
+	}
+	c.println("These values are already exist.")
+	c.println()
+	dumpVariables(c.info(), overwrittens)
+	c.println()
+	yes, err := c.ui.YesNo("Do you want to update all the variables?")
+	if err != nil || !yes {
+		return nil, false, err
+	}
+	return pvs, true, nil
+}
+
+// createVariables creates or updates each variable and continues even if some of them fail
+// The returned results correspond to pvs by index
+func (c *Client) createVariables(ctx context.Context, pvs []*circleci.ProjectVariable) []*ResultRecord {
+	ops := make([]*operation, len(pvs))
+	for i, pv := range pvs {
+		pv := pv
+		ops[i] = &operation{kind: "create", name: pv.Name, value: pv.Value, call: func(ctx context.Context) error {
+			_, err := c.ci.Projects.CreateVariable(ctx, c.projectSlug, circleci.ProjectCreateVariableOptions{
+				Name:  &pv.Name,
+				Value: &pv.Value,
+			})
+			return err
+		}}
+	}
+	rs := executeOperations(ctx, c.opts, &c.reporter, ops)
+	c.audit.recordOperations(ctx, c.projectSlug, "", ops, rs)
+	return rs
 }
 
-func (c *Client) UpdateOrCreateVariable(ctx context.Context, key string, val string) error {
+// UpdateOrCreateVariable creates or updates a variable
+// ErrCancelled is returned if the user cancelled
+func (c *Client) UpdateOrCreateVariable(ctx context.Context, key string, val string) (*ResultRecord, error) {
 	v, _ := c.ci.Projects.GetVariable(ctx, c.projectSlug, key)
+	if v != nil && c.opts.NoOverwrite {
+		c.printf("key:%s already exists as value=%s. Skipped.\n", v.Name, v.Value)
+		return &ResultRecord{Name: key, Operation: "create", Result: ResultSkipped}, nil
+	}
 	if v != nil {
-		fmt.Printf("key:%s already exists as value=%s\n", v.Name, v.Value)
+		c.printf("key:%s already exists as value=%s\n", v.Name, v.Value)
 		yes, err := c.ui.YesNo("Do you want to overwrite?")
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if !yes {
-			fmt.Println("Cancelled.")
-			return nil
+			c.println("Cancelled.")
+			return nil, ErrCancelled
 		}
 	}
+	if c.opts.DryRun {
+		return c.planned("create", key), nil
+	}
 	pv, err := c.ci.Projects.CreateVariable(ctx, c.projectSlug, circleci.ProjectCreateVariableOptions{
 		Name:  &key,
 		Value: &val,
 	})
+	c.audit.recordResult(ctx, c.projectSlug, "create", key, val, newResultRecord(key, "create", err))
 	if err != nil {
-		return fmt.Errorf("update or create variable for key=%s: %w", key, err)
+		return nil, fmt.Errorf("update or create variable for key=%s: %w", key, err)
 	}
-	fmt.Printf("%s=%s is created\n", pv.Name, pv.Value)
-	return nil
+	c.printf("%s=%s is created\n", pv.Name, pv.Value)
+	return newResultRecord(pv.Name, "create", nil), nil
 }
 
 func (c *Client) listAllVariables(ctx context.Context) ([]*circleci.ProjectVariable, error) {
-	opts := circleci.ProjectListVariablesOptions{}
-	pv, err := c.ci.Projects.ListVariables(ctx, c.projectSlug, opts)
+	pvs, err := listAllPages(ctx, func(ctx context.Context, token *string) ([]*circleci.ProjectVariable, string, error) {
+		opts := circleci.ProjectListVariablesOptions{PageToken: token}
+		pv, err := c.ci.Projects.ListVariables(ctx, c.projectSlug, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return pv.Items, pv.NextPageToken, nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("listing all variables: %w", err)
 	}
-	if pv.NextPageToken != "" {
-		logrus.Warn("Warning! Not all variables are listed.")
-	}
-	return pv.Items, nil
+	return pvs, nil
 }
 
-func (c *Client) ListVariables(ctx context.Context) error {
+// ListVariables lists the variables of the project. The values are masked by CircleCI.
+func (c *Client) ListVariables(ctx context.Context) ([]*VariableRecord, error) {
 	vs, err := c.listAllVariables(ctx)
 	if err != nil {
-		return fmt.Errorf("list vars: %w", err)
+		return nil, fmt.Errorf("list vars: %w", err)
+	}
+	return toVariableRecords(vs), nil
+}
+
+func toVariableRecords(pvs []*circleci.ProjectVariable) []*VariableRecord {
+	rs := make([]*VariableRecord, len(pvs))
+	for i, v := range pvs {
+		rs[i] = &VariableRecord{Name: v.Name, Value: v.Value}
 	}
-	dumpVariables(vs)
-	return nil
+	return rs
+}
+
+// apiBase returns baseURL or the default one if it is empty
+func apiBase(baseURL string) string {
+	if baseURL == "" {
+		return apiV2URL
+	}
+	return baseURL
 }
 
 func (c *Client) request(ctx context.Context, path string) ([]byte, error) {
-	url := fmt.Sprintf("https://circleci.com/api/v2/project/%s%s", c.projectSlug, path)
-	req, err := http.NewRequest("GET", url, nil)
+	url := fmt.Sprintf("%s/project/%s%s", apiBase(c.baseURL), c.projectSlug, path)
+	return requestURL(ctx, c.httpClient, c.token, url)
+}
+
+func requestURL(ctx context.Context, hc *http.Client, token string, url string) ([]byte, error) {
+	return doRequest(ctx, hc, token, "GET", url, nil)
+}
+
+// doRequest sends a request to the CircleCI API. body is encoded as JSON if it is not nil.
+// http.DefaultClient is used if hc is nil.
+func doRequest(ctx context.Context, hc *http.Client, token string, method string, url string, body interface{}) ([]byte, error) {
+	var rd io.Reader
+	if body != nil {
+		bt, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("request: %w", err)
+		}
+		rd = bytes.NewReader(bt)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, rd)
 	if err != nil {
 		return nil, fmt.Errorf("request: %w", err)
 	}
-	req.Header.Add("Circle-Token", c.token)
-	res, err := http.DefaultClient.Do(req)
+	req.Header.Add("Circle-Token", token)
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request: %w", err)
 	}
 	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	bt, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("request: %w", err)
 	}
-	return body, nil
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("request: %s: %w", res.Status, circleci.ErrUnauthorized)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("request: %s: %s", res.Status, string(bt))
+	}
+	return bt, nil
 }
 
-func (c *Client) ShowProject(ctx context.Context) error {
+// ShowProject returns the project information as it is returned by the API
+func (c *Client) ShowProject(ctx context.Context) (map[string]interface{}, error) {
 	body, err := c.request(ctx, "")
 	if err != nil {
-		return fmt.Errorf("show project: %w", err)
+		return nil, fmt.Errorf("show project: %w", err)
 	}
-	var v interface{}
+	var v map[string]interface{}
 	if err := json.Unmarshal(body, &v); err != nil {
-		return fmt.Errorf("show project: %w", err)
-	}
-	bt, err := json.MarshalIndent(v, "", "  ")
-	if err != nil {
-		return fmt.Errorf("show project: %w", err)
+		return nil, fmt.Errorf("show project: %w", err)
 	}
-	fmt.Println(string(bt))
-	return nil
+	return v, nil
 }
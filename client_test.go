@@ -1,11 +1,14 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -161,7 +164,7 @@ func TestClient_DeleteVariablesInteractive(t *testing.T) {
 		ui:          ui,
 		token:       testAPIToken,
 	}
-	if err := c.DeleteVariablesInteractive(context.Background()); err != nil {
+	if _, err := c.DeleteVariablesInteractive(context.Background()); err != nil {
 		t.Error(err)
 	}
 	info := httpmock.GetCallCountInfo()
@@ -264,7 +267,7 @@ func TestClient_UpdateOrCreateVariable(t *testing.T) {
 				ui:          ui,
 				token:       testAPIToken,
 			}
-			if err := c.UpdateOrCreateVariable(context.Background(), tt.args.pv.Name, tt.args.pv.Value); err != nil {
+			if _, err := c.UpdateOrCreateVariable(context.Background(), tt.args.pv.Name, tt.args.pv.Value); err != nil {
 				t.Errorf("Client.UpdateOrCreateVariable() error = %v", err)
 			}
 		})
@@ -440,9 +443,130 @@ func TestClient_UpdateOrCreateVariablesFromFile(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			c, closer := setupForUpdateOrCreateBulkTest(t, tt.ui, tt.args.created, tt.args.exist)
 			defer closer()
-			if err := c.UpdateOrCreateVariablesFromFile(context.TODO(), tt.args.path, tt.args.format); err != nil {
+			if _, err := c.UpdateOrCreateVariablesFromFile(context.TODO(), tt.args.path, tt.args.format); err != nil {
 				t.Error(err)
 			}
 		})
 	}
 }
+
+func TestClient_listAllVariables(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	expectedListURL := apiBaseURL + "/envvar"
+	pages := []circleci.ProjectVariableList{
+		{
+			Items: []*circleci.ProjectVariable{
+				{Name: "FOO", Value: "xxxx_foo"},
+				{Name: "BAR", Value: "xxxx_bar"},
+			},
+			NextPageToken: "page2",
+		},
+		{
+			Items: []*circleci.ProjectVariable{
+				{Name: "TEST0", Value: "xxxxtest"},
+			},
+			NextPageToken: "page3",
+		},
+		{
+			Items: []*circleci.ProjectVariable{
+				{Name: "TEST1", Value: "xxxxest1"},
+			},
+		},
+	}
+	httpmock.RegisterResponder("GET", expectedListURL, func(r *http.Request) (*http.Response, error) {
+		switch r.URL.Query().Get("page-token") {
+		case "":
+			return httpmock.NewJsonResponse(200, pages[0])
+		case "page2":
+			return httpmock.NewJsonResponse(200, pages[1])
+		case "page3":
+			return httpmock.NewJsonResponse(200, pages[2])
+		}
+		return httpmock.NewStringResponse(400, `{"message":"invalid page token"}`), nil
+	})
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+	c := &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		token:       testAPIToken,
+	}
+	got, err := c.listAllVariables(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*circleci.ProjectVariable{
+		{Name: "FOO", Value: "xxxx_foo"},
+		{Name: "BAR", Value: "xxxx_bar"},
+		{Name: "TEST0", Value: "xxxxtest"},
+		{Name: "TEST1", Value: "xxxxest1"},
+	}
+	assert.Equal(t, expected, got)
+	assert.Equal(t, 3, httpmock.GetTotalCallCount(), "Expected number of list API call is wrong")
+}
+
+func Test_listAllPages_repeatedToken(t *testing.T) {
+	fetch := func(ctx context.Context, token *string) ([]int, string, error) {
+		return []int{1}, "same", nil
+	}
+	if _, err := listAllPages(context.Background(), fetch); err == nil {
+		t.Error("listAllPages() should fail when the same page token is returned twice")
+	}
+}
+
+func TestClient_UpdateOrCreateVariablesFromFile_NoOverwrite(t *testing.T) {
+	created := []*circleci.ProjectVariable{
+		{Name: "TEST_ENV_1", Value: "aaa"},
+	}
+	exist := []*circleci.ProjectVariable{
+		{Name: "TEST_ENV_2", Value: "xxxxabc"},
+	}
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	c, closer := setupForUpdateOrCreateBulkTest(t, ui, created, exist)
+	defer closer()
+	c.opts = Options{NoOverwrite: true}
+	if _, err := c.UpdateOrCreateVariablesFromFile(context.TODO(), "fixtures/dotenv.test", "dotenv"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAssumeYes_YesNo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	var buf bytes.Buffer
+	ui := &AssumeYes{UI: mock_cli.NewMockUI(ctrl), Messages: &buf}
+	yes, err := ui.YesNo("Do you want to continue?")
+	assert.NoError(t, err)
+	assert.True(t, yes)
+	assert.Equal(t, "Do you want to continue? Yes (assumed)\n", buf.String())
+}
+
+func TestPrompt_ReadAll(t *testing.T) {
+	for _, echo := range []bool{false, true} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString("X=1\n")
+		w.Close()
+		stdin := os.Stdin
+		os.Stdin = r
+
+		var buf bytes.Buffer
+		p := &Prompt{Messages: &buf, EchoInput: echo}
+		got, err := p.ReadAll("Please input")
+		os.Stdin = stdin
+		assert.NoError(t, err)
+		assert.Equal(t, "X=1\n", got)
+		assert.Equal(t, echo, strings.Contains(buf.String(), "X=1"), buf.String())
+		assert.True(t, strings.HasPrefix(buf.String(), "Please input\n"))
+	}
+}
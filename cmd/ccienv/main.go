@@ -1,15 +1,15 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"regexp"
+	"os/signal"
 	"strings"
 
 	"github.com/alecthomas/kong"
+	"github.com/grezar/go-circleci"
 	"github.com/sirupsen/logrus"
 	cli "github.com/threepipes/circleci-env"
 	command "github.com/threepipes/circleci-env/commands"
@@ -20,88 +20,268 @@ const version = "1.5.3"
 var cmd struct {
 	Version kong.VersionFlag `short:"v" help:"Display version of this tool."`
 	Org     string           `short:"o" help:"Set your CircleCI organization name. If not specified, the default value is used."`
-	Repo    string           `short:"r" help:"Set your target repository name. If not specified, the origin URL of the current directory's git project is used."`
+	Repo    string           `short:"r" env:"CCIENV_REPO" help:"Set your target repository name. If not specified, the remote URL of the current directory's git project is used."`
+	Remote  string           `env:"CCIENV_REMOTE" help:"Set the git remote to detect the repository. If not specified, the remote in the config or origin is used."`
+	Profile string           `env:"CCIENV_PROFILE" help:"Set the profile of the config. If not specified, the profile whose organization matches the target is used, or the default profile."`
+
+	Vcs         string `enum:",gh,bb,gl,circleci" default:"" placeholder:"VCS" env:"CCIENV_VCS" help:"Set the VCS type of the project slug (gh, bb, gl or circleci). If not specified, it is detected from the git remote, or gh is used."`
+	ProjectSlug string `placeholder:"SLUG" env:"CCIENV_PROJECT_SLUG" help:"Set the project slug directly (e.g. gh/org/repo, circleci/<org-id>/<project-id>). -o, -r and --vcs are ignored."`
+
+	Yes         bool   `short:"y" env:"CCIENV_YES" help:"Answer yes to all the confirmations. Useful for scripts and CI without TTY."`
+	NoOverwrite bool   `env:"CCIENV_NO_OVERWRITE" help:"Skip variables which already exist instead of asking whether to overwrite them."`
+	Output      string `enum:"text,table,json,yaml" default:"text" env:"CCIENV_OUTPUT" help:"Output format of the results. [text|table|json|yaml] In json and yaml, messages other than the results are written to stderr."`
+	MaxAttempts int    `default:"3" env:"CCIENV_MAX_ATTEMPTS" help:"Maximum number of attempts of an API call. Calls are retried on rate limits (429) and server errors (5xx)."`
+	Concurrency int    `default:"4" env:"CCIENV_CONCURRENCY" help:"Maximum number of API calls sent at once when changing multiple variables."`
+	AgeKeyFile  string `type:"path" env:"CCIENV_AGE_KEY_FILE" help:"Set the age identities to decrypt age and sops inputs. If not specified, SOPS_AGE_KEY_FILE or ~/.config/sops/age/keys.txt is used."`
+	DryRun      bool   `env:"CCIENV_DRY_RUN" help:"Show the changes which would be made without making them. Confirmations are skipped."`
 
 	Rm           command.RmCmd           `cmd:"" help:"Remove environment variables. Either environment variables or the interactive flag must be specified."`
 	Ls           command.LsCmd           `cmd:"" help:"List environment variables."`
 	Add          command.AddCmd          `cmd:"" help:"Add an environment variable."`
 	AddFromInput command.AddFromInputCmd `cmd:"" aliases:"addi" help:"Add multiple environment variables from a file or stdin."`
+	Sync         command.SyncCmd         `cmd:"" help:"Make environment variables match a file or stdin. Variables not in the input are removed."`
+	Cp           command.CpCmd           `cmd:"" help:"Copy environment variables from a project to another project."`
+	Diff         command.DiffCmd         `cmd:"" help:"Show differences between a file or stdin and environment variables."`
+	Backup       command.BackupCmd       `cmd:"" help:"Save environment variables into an encrypted file."`
+	Restore      command.RestoreCmd      `cmd:"" help:"Recreate missing environment variables from a backup file."`
 
+	Fanout  command.FanoutCmd  `cmd:"" help:"Apply a change of environment variables to multiple projects at once."`
 	Config  command.ConfigCmd  `cmd:"" help:"Commands for ccienv configurations."`
 	Project command.ProjectCmd `cmd:"" help:"Commands for CircleCI projects."`
+	Context command.ContextCmd `cmd:"" help:"Commands for CircleCI contexts of the organization."`
+	Audit   command.AuditCmd   `cmd:"" help:"Commands for the local audit log of variable changes."`
+}
+
+// Exit codes of ccienv
+const (
+	exitOK = 0
+	// exitFailure is used when an operation fails entirely or the variables differ in diff command
+	exitFailure        = 1
+	exitUsage          = 2
+	exitPartialFailure = 3
+	exitAuth           = 4
+	exitCancelled      = 5
+)
+
+func exitCode(err error) int {
+	var opErr *cli.OperationError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, cli.ErrCancelled), errors.Is(err, context.Canceled):
+		return exitCancelled
+	case errors.Is(err, command.ErrUsage):
+		return exitUsage
+	case errors.Is(err, circleci.ErrUnauthorized):
+		return exitAuth
+	case errors.As(err, &opErr) && opErr.Partial():
+		return exitPartialFailure
+	}
+	return exitFailure
 }
 
 func handleErr(err error) {
-	if err != nil {
+	code := exitCode(err)
+	var opErr *cli.OperationError
+	switch {
+	case code == exitOK:
+		return
+	case code == exitCancelled, errors.Is(err, cli.ErrVariablesDiffer):
+		// The messages are already written
+	case code == exitUsage:
+		fmt.Fprintf(os.Stderr, "ccienv: error: %v\n", err)
+	case errors.As(err, &opErr):
+		logrus.WithField("error", err).Error("Some operations failed.")
+	default:
 		logrus.WithField("error", err).Error("Internal error occured.")
-		os.Exit(1)
 	}
+	os.Exit(code)
 }
 
-func extractRepoName(uri string) (string, string, error) {
-	repoURI := strings.TrimSpace(string(uri))
-	rmSuffix := regexp.MustCompile(`.git/?$`)
-	repo := rmSuffix.ReplaceAllString(repoURI, "")
-	r := regexp.MustCompile(`.+github\.com[:/]([^/]+)/(.+)/?$`)
-	match := r.FindStringSubmatch(repo)
-	if len(match) < 3 {
-		return "", "", fmt.Errorf("failed to parse repo name: %v", repo)
+// selectProfile chooses the settings from the config file overridden by the environment variables
+// The profile specified explicitly is used first, then the profile whose organization is org, then the default profile
+func selectProfile(f *cli.ConfigFile, profile string, org string) (*cli.Config, error) {
+	if profile == "" && org != "" {
+		if name, ok := f.ProfileNameForOrg(org); ok {
+			profile = name
+		}
 	}
-	return match[2], match[1], nil
+	return f.ProfileWithEnv(profile)
 }
 
-func getDefaultRepoName() (string, string) {
-	var stderr bytes.Buffer
-	cmd := exec.Command("git", strings.Split("config --get remote.origin.url", " ")...)
-	cmd.Stderr = &stderr
-	out, err := cmd.Output()
+// readConfig reads the settings for org from the config file and the environment variables
+// The environment variables take precedence over the config file
+func readConfig(org string) (*cli.Config, error) {
+	f, err := cli.ReadConfigFileOrEmpty()
 	if err != nil {
-		logrus.Error("Failed to read git remote repository with git command. Please specify the repository by the `-r` option or go to the directory where .git is with git command.")
-		handleErr(err)
+		return nil, err
 	}
-	repo := strings.TrimSpace(string(out))
-	rn, org, err := extractRepoName(repo)
+	p, err := selectProfile(f, cmd.Profile, org)
 	if err != nil {
-		handleErr(err)
+		return nil, err
 	}
-	return rn, org
-}
-
-func constructProjectSlug(org string, repo string) string {
-	return fmt.Sprintf("gh/%s/%s", org, repo)
+	return p.Validate()
 }
 
 func getClient() (*cli.Client, error) {
-	cfg, err := cli.ReadConfig()
+	if cmd.ProjectSlug != "" {
+		_, org, _, err := splitProjectSlug(cmd.ProjectSlug)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client: %w", err)
+		}
+		cfg, err := readConfig(org)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client: %w", err)
+		}
+		client, err := cli.NewClient(cfg, cmd.ProjectSlug, getOptions())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client: %w", err)
+		}
+		return client, nil
+	}
+
+	org := cmd.Org
+	repo := cmd.Repo
+	detected := vcsGitHub
+	if repo == "" {
+		r, err := getDefaultRepoName()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client: %w", err)
+		}
+		repo, org, detected = r.repo, r.org, r.vcs
+	}
+	vcs, err := getVCS(detected)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
 
+	cfg, err := readConfig(org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	if org == "" {
+		org = cfg.OrganizationName
+	}
+
+	slug := constructProjectSlug(vcs, org, repo)
+	client, err := cli.NewClient(cfg, slug, getOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	return client, nil
+}
+
+func getOutputFormat() outputFormat {
+	// The format is already validated by kong
+	format, _ := validateOutputFormat(cmd.Output)
+	return format
+}
+
+func getOptions() cli.Options {
+	return cli.Options{
+		AssumeYes:   cmd.Yes,
+		NoOverwrite: cmd.NoOverwrite,
+		Messages:    messageWriter(getOutputFormat()),
+		// In json and yaml, the input is not echoed to stderr, which is often recorded by scripts
+		EchoInput:   getOutputFormat() == outputText,
+		MaxAttempts: cmd.MaxAttempts,
+		Concurrency: cmd.Concurrency,
+		DryRun:      cmd.DryRun,
+		AuditLog:    cli.AuditLogPath(),
+		AgeKeyFile:  cmd.AgeKeyFile,
+	}
+}
+
+func getOrg() (string, *cli.Config, error) {
 	org := cmd.Org
+	cfg, err := readConfig(org)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get org: %w", err)
+	}
 	if org == "" {
 		org = cfg.OrganizationName
 	}
-	repo := cmd.Repo
-	if repo == "" {
-		repo, org = getDefaultRepoName()
+	return org, cfg, nil
+}
+
+func getContextClient() (*cli.ContextClient, error) {
+	org, cfg, err := getOrg()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context client: %w", err)
+	}
+	vcs, err := getOwnerVCS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context client: %w", err)
+	}
+	client, err := cli.NewContextClient(cfg, constructOwnerSlug(vcs, org), getOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context client: %w", err)
+	}
+	return client, nil
+}
+
+// orgClient is a client created by getProjectClient and the organization resolved from the config
+type orgClient struct {
+	org    string
+	client *cli.Client
+}
+
+// orgClients are the clients created by getProjectClient for each organization specified
+var orgClients = make(map[string]*orgClient)
+
+// getProjectClient returns a client for the repository in org
+// The clients for the same organization share the HTTP client, so that they wait together on rate limits.
+func getProjectClient(org string, repo string) (*cli.Client, error) {
+	vcs, err := getOwnerVCS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	key := strings.ToLower(org)
+	if oc, ok := orgClients[key]; ok {
+		return oc.client.ForProject(constructProjectSlug(vcs, oc.org, repo)), nil
+	}
+	cfg, err := readConfig(org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	if org == "" {
+		org = cfg.OrganizationName
 	}
 
-	slug := constructProjectSlug(org, repo)
-	client, err := cli.NewClient(cfg, slug)
+	slug := constructProjectSlug(vcs, org, repo)
+	client, err := cli.NewClient(cfg, slug, getOptions())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
+	orgClients[key] = &orgClient{org: org, client: client}
 	return client, nil
 }
 
 func mainRun() {
-	kc := kong.Parse(&cmd, kong.Vars{"version": "ccienv version " + version})
+	kc := kong.Parse(&cmd,
+		kong.Vars{"version": "ccienv version " + version},
+		// kong exits with 1 on parse errors
+		kong.Exit(func(code int) {
+			if code == 1 {
+				code = exitUsage
+			}
+			os.Exit(code)
+		}),
+	)
 
-	ctx := context.Background()
+	// Ctrl-C cancels the API calls in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	err := kc.Run(&command.Context{
-		Ctx:             ctx,
-		ClientGenerator: getClient,
+		Ctx:                    ctx,
+		Profile:                cmd.Profile,
+		ClientGenerator:        getClient,
+		ProjectClientGenerator: getProjectClient,
+		OrgGenerator:           getOrg,
+		ContextClientGenerator: getContextClient,
+		Presenter:              newPresenter(getOutputFormat(), os.Stdout),
+		Options:                getOptions(),
 	})
+	stop()
 	handleErr(err)
 }
 
@@ -1,6 +1,103 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/grezar/go-circleci"
+	cli "github.com/threepipes/circleci-env"
+	command "github.com/threepipes/circleci-env/commands"
+)
+
+func Test_cmd(t *testing.T) {
+	// kong reports invalid definitions of the commands like duplicate flags only at runtime
+	if _, err := kong.New(&cmd, kong.Vars{"version": "ccienv version " + version}); err != nil {
+		t.Errorf("kong.New() error = %v", err)
+	}
+}
+
+// captureOutput returns what run writes to stdout and stderr
+func captureOutput(t *testing.T, run func()) (string, string) {
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout, os.Stderr = outW, errW
+	outC, errC := make(chan string), make(chan string)
+	go func() { bt, _ := io.ReadAll(outR); outC <- string(bt) }()
+	go func() { bt, _ := io.ReadAll(errR); errC <- string(bt) }()
+	run()
+	outW.Close()
+	errW.Close()
+	return <-outC, <-errC
+}
+
+func Test_dryRunJsonOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected request in dry run: %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/envvar") {
+			fmt.Fprint(w, `{"items": [{"name": "BAR", "value": "xxxxabcd"}], "next_page_token": ""}`)
+			return
+		}
+		fmt.Fprint(w, `{"name": "BAR", "value": "xxxxabcd"}`)
+	}))
+	defer srv.Close()
+
+	saved := cmd
+	defer func() { cmd = saved }()
+	parser, err := kong.New(&cmd, kong.Vars{"version": "ccienv version " + version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := captureOutput(t, func() {
+		kc, err := parser.Parse([]string{"--dry-run", "--output", "json", "rm", "BAR"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = kc.Run(&command.Context{
+			Ctx: context.Background(),
+			ClientGenerator: func() (*cli.Client, error) {
+				opts := getOptions()
+				opts.AuditLog = ""
+				return cli.NewClient(&cli.Config{ApiToken: "token", Host: srv.URL}, "gh/org/repo", opts)
+			},
+			Presenter: newPresenter(getOutputFormat(), os.Stdout),
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	var rs []*cli.ResultRecord
+	if err := json.Unmarshal([]byte(stdout), &rs); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, stdout)
+	}
+	if len(rs) != 1 || rs[0].Result != cli.ResultPlanned {
+		t.Errorf("unexpected results: %s", stdout)
+	}
+	if !strings.Contains(stderr, "Yes (assumed)") {
+		t.Errorf("the assumed answer is not written to stderr: %s", stderr)
+	}
+}
 
 func Test_extractRepoName(t *testing.T) {
 	type args struct {
@@ -9,8 +106,7 @@ func Test_extractRepoName(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    string
-		want1   string
+		want    *remoteRepo
 		wantErr bool
 	}{
 		{
@@ -18,48 +114,91 @@ func Test_extractRepoName(t *testing.T) {
 			args: args{
 				repo: "git@github.com:threepipes/circleci-env.git",
 			},
-			want:  "circleci-env",
-			want1: "threepipes",
+			want: &remoteRepo{vcs: "gh", org: "threepipes", repo: "circleci-env"},
 		},
 		{
 			name: "trailing slash",
 			args: args{
 				repo: "git@github.com:threepipes/circleci-env.git/",
 			},
-			want:  "circleci-env",
-			want1: "threepipes",
+			want: &remoteRepo{vcs: "gh", org: "threepipes", repo: "circleci-env"},
 		},
 		{
 			name: "https url",
 			args: args{
 				repo: "https://github.com/user/repo.git",
 			},
-			want:  "repo",
-			want1: "user",
+			want: &remoteRepo{vcs: "gh", org: "user", repo: "repo"},
 		},
 		{
 			name: "https url (.git suffix omitted)",
 			args: args{
 				repo: "https://github.com/user/repo",
 			},
-			want:  "repo",
-			want1: "user",
+			want: &remoteRepo{vcs: "gh", org: "user", repo: "repo"},
+		},
+		{
+			name: "repo name ending with git",
+			args: args{
+				repo: "https://github.com/org/legit",
+			},
+			want: &remoteRepo{vcs: "gh", org: "org", repo: "legit"},
+		},
+		{
+			name: "repo name ending with git (.git suffix)",
+			args: args{
+				repo: "git@bitbucket.org:team/digit.git",
+			},
+			want: &remoteRepo{vcs: "bb", org: "team", repo: "digit"},
 		},
 		{
 			name: "https url containing '.git' in repo name",
 			args: args{
 				repo: "https://github.com/user/repo.git.repo.git",
 			},
-			want:  "repo.git.repo",
-			want1: "user",
+			want: &remoteRepo{vcs: "gh", org: "user", repo: "repo.git.repo"},
 		},
 		{
 			name: "https url containing '.git' in repo name (.git suffix omitted)",
 			args: args{
 				repo: "https://github.com/user/repo.git.repo",
 			},
-			want:  "repo.git.repo",
-			want1: "user",
+			want: &remoteRepo{vcs: "gh", org: "user", repo: "repo.git.repo"},
+		},
+		{
+			name: "bitbucket",
+			args: args{
+				repo: "git@bitbucket.org:team/repo.git",
+			},
+			want: &remoteRepo{vcs: "bb", org: "team", repo: "repo"},
+		},
+		{
+			name: "gitlab with subgroups",
+			args: args{
+				repo: "https://gitlab.com/group/subgroup/repo.git",
+			},
+			want: &remoteRepo{vcs: "gl", org: "group", repo: "subgroup/repo"},
+		},
+		{
+			name: "self-hosted gitlab with ssh port",
+			args: args{
+				repo: "ssh://git@gitlab.example.com:2222/group/repo.git",
+			},
+			want: &remoteRepo{vcs: "gl", org: "group", repo: "repo"},
+		},
+		{
+			name: "ssh host alias",
+			args: args{
+				repo: "git@github.com-work:org/repo.git",
+			},
+			want: &remoteRepo{vcs: "gh", org: "org", repo: "repo"},
+		},
+		{
+			name: "unknown host",
+			args: args{
+				repo: "git@git.example.com:org/repo.git",
+			},
+			want: &remoteRepo{vcs: "", org: "org", repo: "repo"},
 		},
 		{
 			name: "error pattern",
@@ -71,17 +210,89 @@ func Test_extractRepoName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := extractRepoName(tt.args.repo)
+			got, err := extractRepoName(tt.args.repo)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("extractRepoName() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("extractRepoName() got = %v, want %v", got, tt.want)
 			}
-			if got1 != tt.want1 {
-				t.Errorf("extractRepoName() got1 = %v, want %v", got1, tt.want1)
+		})
+	}
+}
+
+func Test_exitCode(t *testing.T) {
+	partial := &cli.OperationError{Total: 2, Failed: []*cli.FailedItem{{Name: "A", Operation: "create", Err: errors.New("boom")}}}
+	total := &cli.OperationError{Total: 1, Failed: []*cli.FailedItem{{Name: "A", Operation: "create", Err: errors.New("boom")}}}
+	unauthorized := &cli.OperationError{Total: 2, Failed: []*cli.FailedItem{{Name: "A", Operation: "create", Err: circleci.ErrUnauthorized}}}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"failure", errors.New("boom"), exitFailure},
+		{"differ", cli.ErrVariablesDiffer, exitFailure},
+		{"total failure", fmt.Errorf("wrapped: %w", total), exitFailure},
+		{"partial failure", partial, exitPartialFailure},
+		{"usage", fmt.Errorf("rm command: %w", command.ErrUsage), exitUsage},
+		{"auth", fmt.Errorf("list vars: %w", circleci.ErrUnauthorized), exitAuth},
+		{"auth in bulk operations", unauthorized, exitAuth},
+		{"cancelled", cli.ErrCancelled, exitCancelled},
+		{"interrupted", fmt.Errorf("list vars: %w", context.Canceled), exitCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func Test_selectProfile(t *testing.T) {
+	f := &cli.ConfigFile{
+		Config: cli.Config{ApiToken: "abc", OrganizationName: "cde"},
+		Profiles: map[string]*cli.Config{
+			"work": {ApiToken: "tkn1", OrganizationName: "org1"},
+		},
+	}
+	tests := []struct {
+		name    string
+		profile string
+		org     string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "abc"},
+		{name: "explicit profile", profile: "work", org: "cde", want: "tkn1"},
+		{name: "profile matching the org", org: "Org1", want: "tkn1"},
+		{name: "no profiles match the org", org: "other", want: "abc"},
+		{name: "unknown profile", profile: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectProfile(f, tt.profile, tt.org)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.ApiToken != tt.want {
+				t.Errorf("selectProfile() = %v, want %v", got.ApiToken, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitProjectSlug(t *testing.T) {
+	vcs, org, repo, err := splitProjectSlug("circleci/org-id/project-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vcs != "circleci" || org != "org-id" || repo != "project-id" {
+		t.Errorf("splitProjectSlug() = %v, %v, %v", vcs, org, repo)
+	}
+	if _, _, _, err := splitProjectSlug("gh/org"); !errors.Is(err, command.ErrUsage) {
+		t.Errorf("splitProjectSlug() error = %v, want usage error", err)
+	}
+}
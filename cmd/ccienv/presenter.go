@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cli "github.com/threepipes/circleci-env"
+	"gopkg.in/yaml.v3"
+)
+
+type outputFormat string
+
+const (
+	// outputText is the default human readable format
+	outputText  outputFormat = "text"
+	outputTable outputFormat = "table"
+	outputJSON  outputFormat = "json"
+	outputYAML  outputFormat = "yaml"
+)
+
+func validateOutputFormat(format string) (outputFormat, error) {
+	switch f := outputFormat(format); f {
+	case "":
+		return outputText, nil
+	case outputText, outputTable, outputJSON, outputYAML:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid output format: %s (allowed: text, table, json, yaml)", format)
+}
+
+// messageWriter returns the writer for messages other than the results
+// In the structured formats, messages are written to stderr so that stdout contains only the results
+func messageWriter(format outputFormat) io.Writer {
+	if format == outputText {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// presenter writes the results of commands in the specified output format
+type presenter struct {
+	format outputFormat
+	w      io.Writer
+}
+
+func newPresenter(format outputFormat, w io.Writer) *presenter {
+	return &presenter{
+		format: format,
+		w:      w,
+	}
+}
+
+// printRecords writes v in a structured format
+// header and rows are used for the table format
+func (p *presenter) printRecords(v interface{}, header []string, rows [][]string) error {
+	switch p.format {
+	case outputJSON:
+		bt, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("print records: %w", err)
+		}
+		fmt.Fprintln(p.w, string(bt))
+	case outputYAML:
+		bt, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("print records: %w", err)
+		}
+		fmt.Fprint(p.w, string(bt))
+	default:
+		tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+func maxLength(ss []string) int {
+	maxlen := 0
+	for _, s := range ss {
+		if len(s) > maxlen {
+			maxlen = len(s)
+		}
+	}
+	return maxlen
+}
+
+func (p *presenter) Variables(vs []*cli.VariableRecord) error {
+	rows := make([][]string, len(vs))
+	names := make([]string, len(vs))
+	for i, v := range vs {
+		rows[i] = []string{v.Name, v.Value}
+		names[i] = v.Name
+	}
+	if p.format != outputText {
+		return p.printRecords(vs, []string{"NAME", "VALUE"}, rows)
+	}
+	maxlen := maxLength(names)
+	for _, v := range vs {
+		fmt.Fprintf(p.w, "%-*s %s\n", maxlen, v.Name, v.Value)
+	}
+	return nil
+}
+
+// Results writes results of mutations
+// Nothing is written in the text format since the results are already written as messages
+func (p *presenter) Results(rs []*cli.ResultRecord) error {
+	if p.format == outputText {
+		return nil
+	}
+	if rs == nil {
+		rs = []*cli.ResultRecord{}
+	}
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		rows[i] = []string{r.Name, r.Operation, r.Result, r.Error}
+	}
+	return p.printRecords(rs, []string{"NAME", "OPERATION", "RESULT", "ERROR"}, rows)
+}
+
+func (p *presenter) dumpNames(msg string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintln(p.w, msg)
+	for _, n := range names {
+		fmt.Fprintln(p.w, "  "+n)
+	}
+	fmt.Fprintln(p.w)
+}
+
+func (p *presenter) Diff(rs []*cli.DiffRecord) error {
+	if p.format != outputText {
+		rows := make([][]string, len(rs))
+		for i, r := range rs {
+			rows[i] = []string{r.Name, r.Status}
+		}
+		return p.printRecords(rs, []string{"NAME", "STATUS"}, rows)
+	}
+	if !cli.HasDifference(rs) {
+		fmt.Fprintln(p.w, "There are no differences.")
+		return nil
+	}
+	groups := make(map[string][]string)
+	for _, r := range rs {
+		groups[r.Status] = append(groups[r.Status], r.Name)
+	}
+	p.dumpNames("Only in local:", groups[cli.DiffOnlyLocal])
+	p.dumpNames("Only in project:", groups[cli.DiffOnlyRemote])
+	p.dumpNames("Likely changed (the last 4 characters differ):", groups[cli.DiffChanged])
+	p.dumpNames("Likely unchanged:", groups[cli.DiffUnchanged])
+	return nil
+}
+
+// ProjectResults writes the results of fanout. The text format is the same as the table format.
+func (p *presenter) ProjectResults(rs []*cli.ProjectResultRecord) error {
+	if rs == nil {
+		rs = []*cli.ProjectResultRecord{}
+	}
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		detail := r.Detail
+		if r.Error != "" {
+			detail = r.Error
+		}
+		rows[i] = []string{r.Project, r.Result, detail}
+	}
+	return p.printRecords(rs, []string{"PROJECT", "RESULT", "DETAIL"}, rows)
+}
+
+// keyValueRows converts a map into sorted rows of keys and values
+// Values which are not strings are written in JSON
+func keyValueRows(mp map[string]interface{}) [][]string {
+	keys := make([]string, 0, len(mp))
+	for k := range mp {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		val, ok := mp[k].(string)
+		if !ok {
+			bt, _ := json.Marshal(mp[k])
+			val = string(bt)
+		}
+		rows[i] = []string{k, val}
+	}
+	return rows
+}
+
+// Project writes the project information. The text format is the same as the json format.
+func (p *presenter) Project(v map[string]interface{}) error {
+	if p.format == outputYAML || p.format == outputTable {
+		return p.printRecords(v, []string{"KEY", "VALUE"}, keyValueRows(v))
+	}
+	bt, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("print project: %w", err)
+	}
+	fmt.Fprintln(p.w, string(bt))
+	return nil
+}
+
+func (p *presenter) Contexts(rs []*cli.ContextRecord) error {
+	rows := make([][]string, len(rs))
+	names := make([]string, len(rs))
+	for i, r := range rs {
+		rows[i] = []string{r.Name, r.ID, r.CreatedAt}
+		names[i] = r.Name
+	}
+	if p.format != outputText {
+		return p.printRecords(rs, []string{"NAME", "ID", "CREATED_AT"}, rows)
+	}
+	maxlen := maxLength(names)
+	for _, r := range rs {
+		fmt.Fprintf(p.w, "%-*s %s %s\n", maxlen, r.Name, r.ID, r.CreatedAt)
+	}
+	return nil
+}
+
+func (p *presenter) dumpContextVariables(rs []*cli.ContextVariableRecord) {
+	names := make([]string, len(rs))
+	for i, r := range rs {
+		names[i] = r.Name
+	}
+	maxlen := maxLength(names)
+	for _, r := range rs {
+		fmt.Fprintf(p.w, "%-*s %s\n", maxlen, r.Name, r.UpdatedAt)
+	}
+}
+
+func (p *presenter) ContextDetail(r *cli.ContextDetailRecord) error {
+	if p.format != outputText {
+		names := make([]string, len(r.Variables))
+		for i, v := range r.Variables {
+			names[i] = v.Name
+		}
+		rows := [][]string{
+			{"name", r.Name},
+			{"id", r.ID},
+			{"created_at", r.CreatedAt},
+			{"variables", strings.Join(names, ",")},
+		}
+		return p.printRecords(r, []string{"KEY", "VALUE"}, rows)
+	}
+	fmt.Fprintf(p.w, "Name:      %s\n", r.Name)
+	fmt.Fprintf(p.w, "ID:        %s\n", r.ID)
+	fmt.Fprintf(p.w, "CreatedAt: %s\n", r.CreatedAt)
+	fmt.Fprintf(p.w, "Variables: %d\n", len(r.Variables))
+	fmt.Fprintln(p.w)
+	p.dumpContextVariables(r.Variables)
+	return nil
+}
+
+func (p *presenter) ContextVariables(rs []*cli.ContextVariableRecord) error {
+	if p.format != outputText {
+		rows := make([][]string, len(rs))
+		for i, r := range rs {
+			rows[i] = []string{r.Name, r.UpdatedAt}
+		}
+		return p.printRecords(rs, []string{"NAME", "UPDATED_AT"}, rows)
+	}
+	p.dumpContextVariables(rs)
+	return nil
+}
+
+func (p *presenter) Restrictions(rs []*cli.RestrictionRecord) error {
+	rows := make([][]string, len(rs))
+	ids := make([]string, len(rs))
+	for i, r := range rs {
+		rows[i] = []string{r.ID, string(r.Type), r.Value, r.Name}
+		ids[i] = r.ID
+	}
+	if p.format != outputText {
+		return p.printRecords(rs, []string{"ID", "TYPE", "VALUE", "NAME"}, rows)
+	}
+	maxlen := maxLength(ids)
+	for _, r := range rs {
+		desc := r.Value
+		if r.Name != "" {
+			desc = fmt.Sprintf("%s (%s)", r.Value, r.Name)
+		}
+		fmt.Fprintf(p.w, "%-*s %-10s %s\n", maxlen, r.ID, r.Type, desc)
+	}
+	return nil
+}
+
+// ConfigEntries writes the settings in the same form as `git config --list` in the text format
+func (p *presenter) ConfigEntries(rs []*cli.ConfigEntryRecord) error {
+	if p.format != outputText {
+		rows := make([][]string, len(rs))
+		for i, r := range rs {
+			rows[i] = []string{r.Profile, r.Key, r.Value}
+		}
+		return p.printRecords(rs, []string{"PROFILE", "KEY", "VALUE"}, rows)
+	}
+	for _, r := range rs {
+		key := r.Key
+		if r.Profile != "" {
+			key = r.Profile + "." + r.Key
+		}
+		fmt.Fprintf(p.w, "%s=%s\n", key, r.Value)
+	}
+	return nil
+}
+
+func (p *presenter) User(r *cli.UserRecord) error {
+	if p.format != outputText {
+		rows := [][]string{
+			{"id", r.ID},
+			{"login", r.Login},
+			{"name", r.Name},
+		}
+		return p.printRecords(r, []string{"KEY", "VALUE"}, rows)
+	}
+	fmt.Fprintf(p.w, "The API token is valid.\n")
+	fmt.Fprintf(p.w, "Login: %s\n", r.Login)
+	fmt.Fprintf(p.w, "Name:  %s\n", r.Name)
+	fmt.Fprintf(p.w, "ID:    %s\n", r.ID)
+	return nil
+}
+
+// AuditRecords writes records of the audit log. The text format is the same as the table format.
+func (p *presenter) AuditRecords(rs []*cli.AuditRecord) error {
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		target := r.Project
+		if r.Context != "" {
+			target = "context:" + r.Context
+		}
+		result := r.Result
+		if r.Error != "" {
+			result += ": " + r.Error
+		}
+		rows[i] = []string{r.Timestamp.Local().Format(time.RFC3339), r.User, target, r.Operation, r.Name, r.Value, result}
+	}
+	return p.printRecords(rs, []string{"TIMESTAMP", "USER", "TARGET", "OPERATION", "NAME", "VALUE", "RESULT"}, rows)
+}
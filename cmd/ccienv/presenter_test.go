@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	cli "github.com/threepipes/circleci-env"
+)
+
+func Test_validateOutputFormat(t *testing.T) {
+	f, err := validateOutputFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, outputText, f)
+
+	f, err = validateOutputFormat("yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, outputYAML, f)
+
+	_, err = validateOutputFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestPresenter_Results(t *testing.T) {
+	rs := []*cli.ResultRecord{
+		{Name: "ENV1", Operation: "create", Result: cli.ResultSucceeded},
+		{Name: "ENV2", Operation: "delete", Result: cli.ResultFailed, Error: "not found"},
+	}
+
+	cases := []struct {
+		format   outputFormat
+		expected string
+	}{
+		{outputText, ""},
+		{outputJSON, `[
+  {
+    "name": "ENV1",
+    "operation": "create",
+    "result": "succeeded"
+  },
+  {
+    "name": "ENV2",
+    "operation": "delete",
+    "result": "failed",
+    "error": "not found"
+  }
+]
+`},
+		{outputYAML, `- name: ENV1
+  operation: create
+  result: succeeded
+- name: ENV2
+  operation: delete
+  result: failed
+  error: not found
+`},
+		{outputTable, "NAME  OPERATION  RESULT     ERROR\n" +
+			"ENV1  create     succeeded  \n" +
+			"ENV2  delete     failed     not found\n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		p := newPresenter(c.format, &buf)
+		if err := p.Results(rs); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, c.expected, buf.String(), c.format)
+	}
+}
+
+func TestPresenter_Results_cancelled(t *testing.T) {
+	var buf bytes.Buffer
+	p := newPresenter(outputJSON, &buf)
+	if err := p.Results(nil); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestPresenter_Diff(t *testing.T) {
+	rs := []*cli.DiffRecord{
+		{Name: "LOCAL_ONLY", Status: cli.DiffOnlyLocal},
+		{Name: "SAME", Status: cli.DiffUnchanged},
+	}
+	var buf bytes.Buffer
+	p := newPresenter(outputText, &buf)
+	if err := p.Diff(rs); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "Only in local:\n  LOCAL_ONLY\n\nLikely unchanged:\n  SAME\n\n", buf.String())
+
+	buf.Reset()
+	if err := p.Diff(rs[1:]); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "There are no differences.\n", buf.String())
+}
+
+func TestPresenter_Variables(t *testing.T) {
+	vs := []*cli.VariableRecord{
+		{Name: "A", Value: "xxxx1234"},
+		{Name: "LONG_NAME", Value: "xxxx5678"},
+	}
+	var buf bytes.Buffer
+	p := newPresenter(outputText, &buf)
+	if err := p.Variables(vs); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "A         xxxx1234\nLONG_NAME xxxx5678\n", buf.String())
+}
+
+func TestPresenter_ConfigEntries(t *testing.T) {
+	rs := []*cli.ConfigEntryRecord{
+		{Key: "defaultprofile", Value: "work"},
+		{Profile: "work", Key: "apitoken", Value: "xxxx1234"},
+	}
+	var buf bytes.Buffer
+	p := newPresenter(outputText, &buf)
+	if err := p.ConfigEntries(rs); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "defaultprofile=work\nwork.apitoken=xxxx1234\n", buf.String())
+}
+
+func TestPresenter_AuditRecords(t *testing.T) {
+	ts := time.Date(2023, 5, 1, 12, 0, 0, 0, time.Local)
+	rs := []*cli.AuditRecord{
+		{Timestamp: ts, User: "octocat", Project: "gh/org/repo", Operation: "create", Name: "FOO", Value: "xxxx_new", Result: cli.ResultSucceeded},
+		{Timestamp: ts, User: "octocat", Context: "shared", Operation: "delete", Name: "BAR", Result: cli.ResultFailed, Error: "boom"},
+	}
+	var buf bytes.Buffer
+	p := newPresenter(outputText, &buf)
+	if err := p.AuditRecords(rs); err != nil {
+		t.Error(err)
+	}
+	stamp := ts.Format(time.RFC3339)
+	assert.Equal(t, "TIMESTAMP"+strings.Repeat(" ", len(stamp)-7)+"USER     TARGET          OPERATION  NAME  VALUE     RESULT\n"+
+		stamp+"  octocat  gh/org/repo     create     FOO   xxxx_new  succeeded\n"+
+		stamp+"  octocat  context:shared  delete     BAR             failed: boom\n", buf.String())
+}
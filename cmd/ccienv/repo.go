@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	cli "github.com/threepipes/circleci-env"
+	command "github.com/threepipes/circleci-env/commands"
+)
+
+// VCS types used in project slugs of CircleCI
+const (
+	vcsGitHub    = "gh"
+	vcsBitbucket = "bb"
+	vcsGitLab    = "gl"
+	// vcsCircleCI is used for projects integrated by the CircleCI GitHub App or GitLab.
+	// The slug is `circleci/<org-id>/<project-id>`.
+	vcsCircleCI = "circleci"
+)
+
+// remoteRepo is a repository parsed from a git remote URL
+type remoteRepo struct {
+	// vcs is empty if it cannot be detected from the host
+	vcs  string
+	org  string
+	repo string
+}
+
+// defaultRemote is the git remote used if it is specified by neither the flag nor the config
+const defaultRemote = "origin"
+
+// resolveSSHHost returns the real host name of an SSH host alias in ~/.ssh/config
+// alias itself is returned if it cannot be resolved
+var resolveSSHHost = func(alias string) string {
+	out, err := exec.Command("ssh", "-G", alias).Output()
+	if err != nil {
+		return alias
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, " "); ok && k == "hostname" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return alias
+}
+
+// detectVCS detects the VCS type from the host of a remote URL
+// Hosts are matched by substrings so that self-hosted GitLab (e.g. gitlab.example.com) and
+// SSH host aliases containing the original host (e.g. github.com-work) are also detected.
+func detectVCS(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case strings.Contains(host, "github"):
+		return vcsGitHub
+	case strings.Contains(host, "bitbucket"):
+		return vcsBitbucket
+	case strings.Contains(host, "gitlab"):
+		return vcsGitLab
+	}
+	return ""
+}
+
+var (
+	// e.g. https://github.com/org/repo, ssh://git@gitlab.com:22/org/repo
+	remoteURLPattern = regexp.MustCompile(`^[a-z0-9+.-]+://(?:[^@/]+@)?([^/:]+)(?::\d*)?/([^/]+)/(.+)$`)
+	// e.g. git@bitbucket.org:org/repo
+	remoteSCPPattern = regexp.MustCompile(`^(?:[^@/]+@)?([^/:]+):/?([^/]+)/(.+)$`)
+	// gitSuffixPattern matches the `.git` suffix of remote URLs
+	gitSuffixPattern = regexp.MustCompile(`\.git/?$`)
+)
+
+func extractRepoName(uri string) (*remoteRepo, error) {
+	repoURI := strings.TrimSpace(string(uri))
+	repo := strings.TrimSuffix(gitSuffixPattern.ReplaceAllString(repoURI, ""), "/")
+	match := remoteURLPattern.FindStringSubmatch(repo)
+	if match == nil {
+		match = remoteSCPPattern.FindStringSubmatch(repo)
+	}
+	if match == nil {
+		return nil, fmt.Errorf("failed to parse repo name: %v", repo)
+	}
+	vcs := detectVCS(match[1])
+	if vcs == "" {
+		// The host may be an SSH host alias such as `gh-work`
+		vcs = detectVCS(resolveSSHHost(match[1]))
+	}
+	return &remoteRepo{
+		vcs:  vcs,
+		org:  match[2],
+		repo: match[3],
+	}, nil
+}
+
+// getRemoteURL returns the URL of the git remote of the repository containing dir
+// `url.<base>.insteadOf` rewrites are applied. dir can be a subdirectory or a worktree.
+func getRemoteURL(dir string, remote string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "remote", "get-url", remote)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read git remote %s: %w: %s", remote, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// getRemoteName returns the git remote specified by the flag or the config
+func getRemoteName() (string, error) {
+	if cmd.Remote != "" {
+		return cmd.Remote, nil
+	}
+	f, err := cli.ReadConfigFileOrEmpty()
+	if err != nil {
+		return "", err
+	}
+	if f.Remote != "" {
+		return f.Remote, nil
+	}
+	return defaultRemote, nil
+}
+
+func getDefaultRepoName() (*remoteRepo, error) {
+	remote, err := getRemoteName()
+	if err != nil {
+		return nil, err
+	}
+	uri, err := getRemoteURL("", remote)
+	if err != nil {
+		return nil, fmt.Errorf("%w. Please specify the repository by the `-r` option or go to the directory of a git repository", err)
+	}
+	return extractRepoName(uri)
+}
+
+// getVCS returns the VCS type specified by the flag, or detected one
+func getVCS(detected string) (string, error) {
+	if cmd.Vcs != "" {
+		return cmd.Vcs, nil
+	}
+	if detected == "" {
+		return "", fmt.Errorf("%w: failed to detect the VCS from the git remote. Please specify it by --vcs", command.ErrUsage)
+	}
+	return detected, nil
+}
+
+// remoteVCS caches the VCS detected by getOwnerVCS since it runs git
+var remoteVCS *string
+
+// getOwnerVCS returns the VCS for the commands which take organizations instead of the current repository (e.g. context, cp and fanout)
+// The VCS is detected from the git remote in the same way as the project commands. GitHub is used outside git repositories.
+func getOwnerVCS() (string, error) {
+	if cmd.Vcs != "" {
+		return cmd.Vcs, nil
+	}
+	if remoteVCS == nil {
+		vcs := vcsGitHub
+		if r, err := getDefaultRepoName(); err == nil {
+			vcs = r.vcs
+		} else {
+			logrus.WithField("error", err).Debug("Failed to detect the VCS from the git remote. GitHub is used.")
+		}
+		remoteVCS = &vcs
+	}
+	return getVCS(*remoteVCS)
+}
+
+func constructProjectSlug(vcs string, org string, repo string) string {
+	return fmt.Sprintf("%s/%s/%s", vcs, org, repo)
+}
+
+func constructOwnerSlug(vcs string, org string) string {
+	return fmt.Sprintf("%s/%s", vcs, org)
+}
+
+// splitProjectSlug splits `<vcs>/<org>/<repo>` into its parts
+func splitProjectSlug(slug string) (string, string, string, error) {
+	ss := strings.SplitN(slug, "/", 3)
+	if len(ss) != 3 || ss[0] == "" || ss[1] == "" || ss[2] == "" {
+		return "", "", "", fmt.Errorf("%w: invalid project slug: %s (expected <vcs>/<org>/<repo>)", command.ErrUsage, slug)
+	}
+	return ss[0], ss[1], ss[2], nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_extractRepoName_sshAlias(t *testing.T) {
+	orig := resolveSSHHost
+	defer func() { resolveSSHHost = orig }()
+	resolveSSHHost = func(alias string) string {
+		if alias == "gh-work" {
+			return "github.com"
+		}
+		return alias
+	}
+
+	got, err := extractRepoName("gh-work:org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &remoteRepo{vcs: "gh", org: "org", repo: "repo"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractRepoName() got = %v, want %v", got, want)
+	}
+}
+
+func Test_getRemoteURL(t *testing.T) {
+	dir := t.TempDir()
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	repo := filepath.Join(dir, "repo")
+	git(dir, "init", "-q", repo)
+	git(repo, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "init")
+	git(repo, "remote", "add", "origin", "https://github.com/fork/repo.git")
+	git(repo, "remote", "add", "upstream", "work:org/repo.git")
+	git(repo, "config", "url.git@gitlab.com:.insteadOf", "work:")
+	git(repo, "worktree", "add", "-q", filepath.Join(dir, "wt"))
+	sub := filepath.Join(repo, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		remote  string
+		want    string
+		wantErr bool
+	}{
+		{name: "origin", dir: repo, remote: "origin", want: "https://github.com/fork/repo.git"},
+		{name: "insteadOf", dir: repo, remote: "upstream", want: "git@gitlab.com:org/repo.git"},
+		{name: "subdirectory", dir: sub, remote: "origin", want: "https://github.com/fork/repo.git"},
+		{name: "worktree", dir: filepath.Join(dir, "wt"), remote: "upstream", want: "git@gitlab.com:org/repo.git"},
+		{name: "unknown remote", dir: repo, remote: "unknown", wantErr: true},
+		{name: "not a repository", dir: dir, remote: "origin", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getRemoteURL(tt.dir, tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getRemoteURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getRemoteURL() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getOwnerVCS(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, savedResolve := cmd, resolveSSHHost
+	defer func() {
+		os.Chdir(wd)
+		cmd, resolveSSHHost, remoteVCS = saved, savedResolve, nil
+	}()
+	resolveSSHHost = func(alias string) string { return alias }
+	cmd.Remote = "origin"
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		vcs     string
+		want    string
+		wantErr bool
+	}{
+		{name: "outside git repositories", want: vcsGitHub},
+		{name: "bitbucket", remote: "git@bitbucket.org:team/repo.git", want: vcsBitbucket},
+		{name: "gitlab", remote: "https://gitlab.example.com/group/repo.git", want: vcsGitLab},
+		{name: "flag", remote: "https://gitlab.example.com/group/repo.git", vcs: "gh", want: vcsGitHub},
+		{name: "unknown host", remote: "git@git.example.com:org/repo.git", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.remote != "" {
+				if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+					git("init", "-q")
+					git("remote", "add", "origin", tt.remote)
+				}
+				git("remote", "set-url", "origin", tt.remote)
+			}
+			cmd.Vcs, remoteVCS = tt.vcs, nil
+			got, err := getOwnerVCS()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getOwnerVCS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getOwnerVCS() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	cli "github.com/threepipes/circleci-env"
+)
+
+type AuditCmd struct {
+	Ls   AuditLsCmd   `cmd:"" help:"List the changes of environment variables recorded in the audit log."`
+	Show AuditShowCmd `cmd:"" help:"Show the history of an environment variable of the project."`
+}
+
+type auditPeriod struct {
+	Since string `name:"since" help:"Show changes at or after the date. [YYYY-MM-DD|RFC3339]"`
+	Until string `name:"until" help:"Show changes until the date. A date without time includes the whole day. [YYYY-MM-DD|RFC3339]"`
+}
+
+const dateLayout = "2006-01-02"
+
+// parseDate parses a date in the local time zone or a time in RFC3339
+// The returned bool reports whether s is a date without time
+func parseDate(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(dateLayout, s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, usageErrorf("invalid date: %s (expected YYYY-MM-DD or RFC3339)", s)
+	}
+	return t, false, nil
+}
+
+// filter converts the period into a filter of the audit log
+func (p *auditPeriod) filter() (cli.AuditFilter, error) {
+	var f cli.AuditFilter
+	if p.Since != "" {
+		t, _, err := parseDate(p.Since)
+		if err != nil {
+			return f, err
+		}
+		f.Since = t
+	}
+	if p.Until != "" {
+		t, dateOnly, err := parseDate(p.Until)
+		if err != nil {
+			return f, err
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		f.Until = t
+	}
+	return f, nil
+}
+
+type AuditLsCmd struct {
+	auditPeriod `embed:""`
+
+	Project string `name:"project" help:"Show changes of the project slug. (e.g. gh/org/repo)"`
+	Context string `name:"context" help:"Show changes of the context."`
+	Name    string `name:"name" help:"Show changes of the environment variable."`
+}
+
+func (l *AuditLsCmd) Help() string {
+	return `
+	The audit log is written in JSON Lines under the XDG state directory. (e.g. ~/.local/state/ccienv/audit.jsonl)
+	Values are masked in the same way as CircleCI.
+	`
+}
+
+func (l *AuditLsCmd) Run(c *Context) error {
+	f, err := l.filter()
+	if err != nil {
+		return fmt.Errorf("audit ls command: %w", err)
+	}
+	f.Project = l.Project
+	f.Context = l.Context
+	f.Name = l.Name
+	rs, err := cli.ReadAuditLog(cli.AuditLogPath(), f)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.AuditRecords(rs)
+}
+
+type AuditShowCmd struct {
+	auditPeriod `embed:""`
+
+	Name string `arg:"" name:"env_name" help:"An environment variable name to be shown."`
+}
+
+func (s *AuditShowCmd) Run(c *Context) error {
+	f, err := s.filter()
+	if err != nil {
+		return fmt.Errorf("audit show command: %w", err)
+	}
+	client, err := c.ClientGenerator()
+	if err != nil {
+		return fmt.Errorf("audit show command: %w", err)
+	}
+	f.Project = client.ProjectSlug()
+	f.Name = s.Name
+	rs, err := cli.ReadAuditLog(cli.AuditLogPath(), f)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.AuditRecords(rs)
+}
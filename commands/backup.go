@@ -0,0 +1,50 @@
+package command
+
+import (
+	"fmt"
+)
+
+type BackupCmd struct {
+	Out        string `name:"out" required:"" help:"A file path where the encrypted backup is written."`
+	File       string `name:"file" short:"f" help:"A file path containing the plaintext values to be saved. If not specified, only the masked values are saved."`
+	Type       string `name:"type" short:"t" help:"Type(Format) of the file. [dotenv|json|yaml|toml|shell|age|sops] (default: detected from the extension or the content)"`
+	Passphrase string `name:"passphrase" env:"CCIENV_BACKUP_PASSPHRASE" help:"A passphrase to encrypt the backup. If not specified, it is asked by prompts."`
+}
+
+func (b *BackupCmd) Help() string {
+	return `
+	Save the names and the masked values of the project's environment variables into a file encrypted with a passphrase.
+	Since CircleCI returns only masked values, the plaintext values are saved only if they are in the file specified by -f.
+	The backup is encrypted in the age format and can also be decrypted by ` + "`age -d`" + `.
+	`
+}
+
+func (b *BackupCmd) Run(c *Context) error {
+	client, err := c.ClientGenerator()
+	if err != nil {
+		return fmt.Errorf("backup command: %w", err)
+	}
+	rs, err := client.BackupVariables(c.Ctx, b.Out, b.File, b.Type, b.Passphrase)
+	return presentResults(c.Presenter, rs, err)
+}
+
+type RestoreCmd struct {
+	Path       string `arg:"" name:"backup" type:"existingfile" help:"A backup file written by the backup command."`
+	Passphrase string `name:"passphrase" env:"CCIENV_BACKUP_PASSPHRASE" help:"A passphrase to decrypt the backup. If not specified, it is asked by prompts."`
+}
+
+func (r *RestoreCmd) Help() string {
+	return `
+	Recreate the variables in the backup which are missing in the project.
+	Existing variables are not changed. Variables without plaintext values in the backup are skipped.
+	`
+}
+
+func (r *RestoreCmd) Run(c *Context) error {
+	client, err := c.ClientGenerator()
+	if err != nil {
+		return fmt.Errorf("restore command: %w", err)
+	}
+	rs, err := client.RestoreVariables(c.Ctx, r.Path, r.Passphrase)
+	return presentResults(c.Presenter, rs, err)
+}
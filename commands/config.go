@@ -1,17 +1,51 @@
 package command
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	cli "github.com/threepipes/circleci-env"
 )
 
 type ConfigCmd struct {
-	Init ConfigInitCmd `cmd:"" help:"Initialize ccienv configurations."`
+	Init     ConfigInitCmd     `cmd:"" help:"Initialize ccienv configurations."`
+	Get      ConfigGetCmd      `cmd:"" help:"Print a setting of the profile."`
+	Set      ConfigSetCmd      `cmd:"" help:"Change a setting of the profile."`
+	Ls       ConfigLsCmd       `cmd:"" help:"List all the settings in the config file. API tokens are masked."`
+	Path     ConfigPathCmd     `cmd:"" help:"Print the path of the config file."`
+	Validate ConfigValidateCmd `cmd:"" help:"Confirm that the API token works and show the user who owns it."`
 }
 
 type ConfigInitCmd struct {
+	Default          bool   `name:"default" help:"Use the profile specified by --profile by default."`
+	CredentialStore  string `name:"credential-store" enum:",file,keyring,helper" default:"" placeholder:"STORE" help:"Where to keep the API tokens (file, keyring or helper). If not specified, the current one is kept."`
+	CredentialHelper string `name:"credential-helper" help:"A command to keep the API tokens for --credential-store=helper (e.g. git-credential-libsecret)."`
+}
+
+func (l *ConfigInitCmd) Help() string {
+	return `
+	Set the settings of the profile specified by the global --profile flag.
+	If --profile is not specified, the settings of the default profile are set.
+	The other settings of the profile such as host, cacert and proxy are kept.
+	`
 }
 
 func (l *ConfigInitCmd) Run(c *Context) error {
+	f, err := cli.ReadConfigFileOrEmpty()
+	if err != nil {
+		return err
+	}
+	name := c.Profile
+	if name == "" {
+		name = cli.DefaultProfileName
+	}
+	// The other settings of the profile (e.g. host) are kept
+	cfg := cli.Config{}
+	if p, err := f.Profile(name); err == nil {
+		cfg = *p
+	}
+
 	prompt := cli.Prompt{}
 	org, err := prompt.ReadLine("Please set your default GitHub organization: ")
 	if err != nil {
@@ -21,9 +55,119 @@ func (l *ConfigInitCmd) Run(c *Context) error {
 	if err != nil {
 		return err
 	}
-	cfg := cli.Config{
-		OrganizationName: org,
-		ApiToken:         token,
+	cfg.OrganizationName = org
+	cfg.ApiToken = token
+	f.SetProfile(c.Profile, &cfg)
+	if l.Default {
+		f.DefaultProfile = strings.ToLower(c.Profile)
+	}
+	if l.CredentialStore != "" {
+		f.CredentialStore = l.CredentialStore
+	}
+	if l.CredentialHelper != "" {
+		f.CredentialHelper = l.CredentialHelper
+	}
+	return cli.WriteConfigFile(f)
+}
+
+type ConfigGetCmd struct {
+	Key string `arg:"" enum:"apitoken,organizationname,defaultprofile,credentialstore,credentialhelper,remote,host,cacert,proxy" help:"A key of the setting (${enum})."`
+}
+
+func (g *ConfigGetCmd) Run(c *Context) error {
+	f, err := cli.ReadConfigFile()
+	if err != nil {
+		return err
+	}
+	v, err := f.Get(c.Profile, g.Key)
+	if err != nil {
+		return fmt.Errorf("config get command: %w", err)
+	}
+	fmt.Println(v)
+	return nil
+}
+
+type ConfigSetCmd struct {
+	Key   string `arg:"" enum:"apitoken,organizationname,defaultprofile,credentialstore,credentialhelper,remote,host,cacert,proxy" help:"A key of the setting (${enum})."`
+	Value string `arg:"" optional:"" help:"A value of the setting. If omitted for apitoken, it is read from a prompt."`
+}
+
+func (s *ConfigSetCmd) Help() string {
+	return `
+	Change a setting of the profile specified by the global --profile flag.
+	The other settings are kept unlike "config init".
+	`
+}
+
+func (s *ConfigSetCmd) Run(c *Context) error {
+	value := s.Value
+	if value == "" && s.Key == cli.ConfigKeyApiToken {
+		// Read the token from a prompt not to leave it in the shell history
+		prompt := cli.Prompt{}
+		v, err := prompt.ReadSecret("Please set your personal API token: ")
+		if err != nil {
+			return err
+		}
+		value = v
+	}
+	f, err := cli.ReadConfigFileOrEmpty()
+	if err != nil {
+		return err
+	}
+	if s.Key == cli.ConfigKeyCredentialStore {
+		// The tokens are moved from the current store to the new one
+		f.LoadCredentials()
+	}
+	if err := f.Set(c.Profile, s.Key, value); err != nil {
+		if errors.Is(err, cli.ErrUnknownConfigKey) {
+			return usageErrorf("%v", err)
+		}
+		return fmt.Errorf("config set command: %w", err)
+	}
+	return cli.WriteConfigFile(f)
+}
+
+type ConfigLsCmd struct {
+}
+
+func (l *ConfigLsCmd) Run(c *Context) error {
+	f, err := cli.ReadConfigFile()
+	if err != nil {
+		return err
+	}
+	return c.Presenter.ConfigEntries(f.Entries())
+}
+
+type ConfigPathCmd struct {
+}
+
+func (p *ConfigPathCmd) Run(c *Context) error {
+	path, err := cli.ConfigPath()
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+type ConfigValidateCmd struct {
+}
+
+func (v *ConfigValidateCmd) Help() string {
+	return `
+	Call the CircleCI API with the settings which are actually used.
+	The environment variables and the profile selection are applied in the same way as the other commands.
+	`
+}
+
+func (v *ConfigValidateCmd) Run(c *Context) error {
+	_, cfg, err := c.OrgGenerator()
+	if err != nil {
+		return fmt.Errorf("config validate command: %w", err)
+	}
+	u, err := cli.CurrentUser(c.Ctx, cfg, c.Options)
+	if err != nil {
+		return fmt.Errorf("config validate command: %w", err)
 	}
-	return cli.WriteConfig(&cfg)
+	return c.Presenter.User(u)
 }
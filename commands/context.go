@@ -2,11 +2,71 @@ package command
 
 import (
 	"context"
+	"errors"
 
 	cli "github.com/threepipes/circleci-env"
 )
 
 type Context struct {
-	Ctx             context.Context
+	Ctx context.Context
+	// Profile is the profile name specified by the global flag
+	Profile         string
 	ClientGenerator func() (*cli.Client, error)
+	// ProjectClientGenerator generates a client for the specified repository instead of the current one
+	ProjectClientGenerator func(org string, repo string) (*cli.Client, error)
+	// OrgGenerator returns the target organization name and the config
+	OrgGenerator func() (string, *cli.Config, error)
+	// ContextClientGenerator generates a client for CircleCI contexts of the organization
+	ContextClientGenerator func() (*cli.ContextClient, error)
+	// Presenter writes the results of commands
+	Presenter Presenter
+	// Options are the options of the clients given by the global flags
+	Options cli.Options
+}
+
+// Presenter writes the results returned by clients
+type Presenter interface {
+	Variables(vs []*cli.VariableRecord) error
+	Results(rs []*cli.ResultRecord) error
+	Diff(rs []*cli.DiffRecord) error
+	ProjectResults(rs []*cli.ProjectResultRecord) error
+	Project(v map[string]interface{}) error
+	Contexts(rs []*cli.ContextRecord) error
+	ContextDetail(r *cli.ContextDetailRecord) error
+	ContextVariables(rs []*cli.ContextVariableRecord) error
+	Restrictions(rs []*cli.RestrictionRecord) error
+	ConfigEntries(rs []*cli.ConfigEntryRecord) error
+	User(r *cli.UserRecord) error
+	AuditRecords(rs []*cli.AuditRecord) error
+}
+
+// presentResults writes rs and returns err
+// Results are written even if some of them failed so that the failures are also reported
+func presentResults(p Presenter, rs []*cli.ResultRecord, err error) error {
+	var opErr *cli.OperationError
+	if err != nil && !errors.As(err, &opErr) {
+		return err
+	}
+	if perr := p.Results(rs); perr != nil {
+		return perr
+	}
+	return err
+}
+
+func presentResult(p Presenter, r *cli.ResultRecord, err error) error {
+	if r == nil {
+		return presentResults(p, nil, err)
+	}
+	return presentResults(p, []*cli.ResultRecord{r}, err)
+}
+
+func presentProjectResults(p Presenter, rs []*cli.ProjectResultRecord, err error) error {
+	var opErr *cli.OperationError
+	if err != nil && !errors.As(err, &opErr) {
+		return err
+	}
+	if perr := p.ProjectResults(rs); perr != nil {
+		return perr
+	}
+	return err
 }
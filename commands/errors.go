@@ -0,0 +1,13 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUsage is wrapped by errors caused by invalid arguments of commands
+var ErrUsage = errors.New("invalid arguments")
+
+func usageErrorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrUsage, fmt.Sprintf(format, a...))
+}
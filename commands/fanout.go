@@ -0,0 +1,97 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grezar/go-circleci"
+	cli "github.com/threepipes/circleci-env"
+)
+
+type FanoutCmd struct {
+	Add FanoutAddCmd `cmd:"" help:"Add or update an environment variable of multiple projects."`
+	Rm  FanoutRmCmd  `cmd:"" help:"Remove environment variables from multiple projects."`
+}
+
+type fanoutTarget struct {
+	Repos []string `name:"repos" sep:"," help:"Comma separated target repositories. [<org>/<repo>|<repo>]"`
+	Match string   `name:"match" help:"A glob pattern of target repository names selected from the projects you follow in the organization. (e.g. 'svc-*')"`
+}
+
+func (t *fanoutTarget) clients(c *Context) ([]*cli.Client, error) {
+	if len(t.Repos) == 0 && t.Match == "" {
+		return nil, usageErrorf("specify target repositories by --repos or --match")
+	}
+	type target struct{ org, repo string }
+	targets := make([]target, 0)
+	for _, r := range t.Repos {
+		org, repo, err := splitRepo(r)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{org, repo})
+	}
+	if t.Match != "" {
+		org, cfg, err := c.OrgGenerator()
+		if err != nil {
+			return nil, err
+		}
+		repos, err := cli.ListFollowedRepos(c.Ctx, cfg, org, t.Match, c.Options)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range repos {
+			targets = append(targets, target{org, r})
+		}
+	}
+
+	clients := make([]*cli.Client, 0, len(targets))
+	seen := make(map[string]bool)
+	for _, tg := range targets {
+		key := strings.ToLower(tg.org + "/" + tg.repo)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		client, err := c.ProjectClientGenerator(tg.org, tg.repo)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+type FanoutAddCmd struct {
+	fanoutTarget `embed:""`
+
+	Name  string `arg:"" name:"name" help:"An environment variable name to be added."`
+	Value string `arg:"" name:"value" help:"An environment variable value to be added."`
+}
+
+func (f *FanoutAddCmd) Run(c *Context) error {
+	clients, err := f.clients(c)
+	if err != nil {
+		return fmt.Errorf("fanout add command: %w", err)
+	}
+	pvs := []*circleci.ProjectVariable{{Name: f.Name, Value: f.Value}}
+	desc := fmt.Sprintf("%s will be added or updated in these projects.", f.Name)
+	rs, err := cli.ApplyToProjects(c.Ctx, clients, desc, cli.PutVariablesOperation(pvs))
+	return presentProjectResults(c.Presenter, rs, err)
+}
+
+type FanoutRmCmd struct {
+	fanoutTarget `embed:""`
+
+	Envs []string `arg:"" name:"env_name" help:"Environment variable names to remove."`
+}
+
+func (f *FanoutRmCmd) Run(c *Context) error {
+	clients, err := f.clients(c)
+	if err != nil {
+		return fmt.Errorf("fanout rm command: %w", err)
+	}
+	desc := fmt.Sprintf("%s will be removed from these projects.", strings.Join(f.Envs, ", "))
+	rs, err := cli.ApplyToProjects(c.Ctx, clients, desc, cli.DeleteVariablesOperation(f.Envs))
+	return presentProjectResults(c.Presenter, rs, err)
+}
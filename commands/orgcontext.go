@@ -0,0 +1,214 @@
+package command
+
+import "fmt"
+
+type ContextCmd struct {
+	Ls     ContextLsCmd     `cmd:"" help:"List contexts of the organization."`
+	Create ContextCreateCmd `cmd:"" help:"Create a context."`
+	Rm     ContextRmCmd     `cmd:"" help:"Remove a context."`
+	Show   ContextShowCmd   `cmd:"" help:"Show the context information and its environment variables."`
+	Env    ContextEnvCmd    `cmd:"" help:"Commands for environment variables of a context."`
+
+	Restriction ContextRestrictionCmd `cmd:"" help:"Commands for restrictions (security groups, projects and expressions) of a context."`
+}
+
+type ContextLsCmd struct {
+}
+
+func (l *ContextLsCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context ls command: %w", err)
+	}
+	cs, err := client.ListContexts(c.Ctx)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.Contexts(cs)
+}
+
+type ContextCreateCmd struct {
+	Name string `arg:"" name:"context" help:"A context name to be created."`
+}
+
+func (cr *ContextCreateCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context create command: %w", err)
+	}
+	r, err := client.CreateContext(c.Ctx, cr.Name)
+	return presentResult(c.Presenter, r, err)
+}
+
+type ContextRmCmd struct {
+	Name string `arg:"" name:"context" help:"A context name to be removed."`
+}
+
+func (r *ContextRmCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context rm command: %w", err)
+	}
+	res, err := client.DeleteContext(c.Ctx, r.Name)
+	return presentResult(c.Presenter, res, err)
+}
+
+type ContextShowCmd struct {
+	Name string `arg:"" name:"context" help:"A context name to be shown."`
+}
+
+func (s *ContextShowCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context show command: %w", err)
+	}
+	r, err := client.ShowContext(c.Ctx, s.Name)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.ContextDetail(r)
+}
+
+type ContextEnvCmd struct {
+	Ls           ContextEnvLsCmd           `cmd:"" help:"List environment variables of a context."`
+	Add          ContextEnvAddCmd          `cmd:"" help:"Add an environment variable to a context."`
+	AddFromInput ContextEnvAddFromInputCmd `cmd:"" aliases:"addi" help:"Add multiple environment variables to a context from a file or stdin."`
+	Rm           ContextEnvRmCmd           `cmd:"" help:"Remove environment variables from a context. Either environment variables or the interactive flag must be specified."`
+}
+
+type ContextEnvLsCmd struct {
+	Context string `arg:"" name:"context" help:"A context name."`
+}
+
+func (l *ContextEnvLsCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context env ls command: %w", err)
+	}
+	vs, err := client.ListContextVariables(c.Ctx, l.Context)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.ContextVariables(vs)
+}
+
+type ContextEnvAddCmd struct {
+	Context string `arg:"" name:"context" help:"A context name."`
+	Name    string `arg:"" name:"name" help:"An environment variable name to be added."`
+	Value   string `arg:"" name:"value" help:"An environment variable value to be added."`
+}
+
+func (a *ContextEnvAddCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context env add command: %w", err)
+	}
+	r, err := client.UpdateOrCreateContextVariable(c.Ctx, a.Context, a.Name, a.Value)
+	return presentResult(c.Presenter, r, err)
+}
+
+type ContextEnvAddFromInputCmd struct {
+	Context string `arg:"" name:"context" help:"A context name."`
+	File    string `name:"file" short:"f" help:"A file path containing environmental variables to be added. If this flag is not specified, stdin will be used."`
+	Type    string `name:"type" short:"t" help:"Type(Format) of input. [dotenv|json|yaml|toml|shell|age|sops] (default: detected from the extension or the content)"`
+}
+
+func (a *ContextEnvAddFromInputCmd) Help() string {
+	return (&AddFromInputCmd{}).Help()
+}
+
+func (a *ContextEnvAddFromInputCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context env adds command: %w", err)
+	}
+	rs, err := client.UpdateOrCreateContextVariablesFromFile(c.Ctx, a.Context, a.File, a.Type)
+	return presentResults(c.Presenter, rs, err)
+}
+
+type ContextEnvRmCmd struct {
+	Context     string   `arg:"" name:"context" help:"A context name."`
+	Envs        []string `arg:"" optional:"" name:"env_name" help:"Environment variable names to remove."`
+	Interactive bool     `optional:"" name:"interactive" short:"i" help:"Launch interactive removal mode."`
+}
+
+func (r *ContextEnvRmCmd) Run(c *Context) error {
+	if len(r.Envs) > 0 && r.Interactive {
+		return usageErrorf("do not specify both args `envs` and `-i, --interactive` in `context env rm` command")
+	}
+	if len(r.Envs) == 0 && !r.Interactive {
+		return usageErrorf("please specify at least one environment variable or set `-i`")
+	}
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context env rm command: %w", err)
+	}
+	if r.Interactive {
+		rs, err := client.DeleteContextVariablesInteractive(c.Ctx, r.Context)
+		return presentResults(c.Presenter, rs, err)
+	}
+	rs, err := client.DeleteContextVariables(c.Ctx, r.Context, r.Envs)
+	return presentResults(c.Presenter, rs, err)
+}
+
+type ContextRestrictionCmd struct {
+	Ls  ContextRestrictionLsCmd  `cmd:"" help:"List restrictions of a context."`
+	Add ContextRestrictionAddCmd `cmd:"" help:"Add a restriction to a context."`
+	Rm  ContextRestrictionRmCmd  `cmd:"" help:"Remove restrictions from a context. Either restriction IDs or the interactive flag must be specified."`
+}
+
+type ContextRestrictionLsCmd struct {
+	Context string `arg:"" name:"context" help:"A context name."`
+}
+
+func (l *ContextRestrictionLsCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context restriction ls command: %w", err)
+	}
+	rs, err := client.ListRestrictions(c.Ctx, l.Context)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.Restrictions(rs)
+}
+
+type ContextRestrictionAddCmd struct {
+	Context string `arg:"" name:"context" help:"A context name."`
+	Type    string `name:"type" short:"t" required:"" enum:"project,expression,group" help:"Type of the restriction. [project|expression|group]"`
+	Value   string `arg:"" name:"value" help:"A restriction value. [project: <org>/<repo>, <repo> or project ID|expression: an expression rule|group: security group ID]"`
+}
+
+func (a *ContextRestrictionAddCmd) Run(c *Context) error {
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context restriction add command: %w", err)
+	}
+	r, err := client.AddRestriction(c.Ctx, a.Context, a.Type, a.Value)
+	return presentResult(c.Presenter, r, err)
+}
+
+type ContextRestrictionRmCmd struct {
+	Context     string   `arg:"" name:"context" help:"A context name."`
+	IDs         []string `arg:"" optional:"" name:"restriction_id" help:"Restriction IDs to remove."`
+	Interactive bool     `optional:"" name:"interactive" short:"i" help:"Launch interactive removal mode."`
+}
+
+func (r *ContextRestrictionRmCmd) Run(c *Context) error {
+	if len(r.IDs) > 0 && r.Interactive {
+		return usageErrorf("do not specify both args `restriction_id` and `-i, --interactive` in `context restriction rm` command")
+	}
+	if len(r.IDs) == 0 && !r.Interactive {
+		return usageErrorf("please specify at least one restriction ID or set `-i`")
+	}
+	client, err := c.ContextClientGenerator()
+	if err != nil {
+		return fmt.Errorf("context restriction rm command: %w", err)
+	}
+	if r.Interactive {
+		rs, err := client.DeleteRestrictionsInteractive(c.Ctx, r.Context)
+		return presentResults(c.Presenter, rs, err)
+	}
+	rs, err := client.DeleteRestrictions(c.Ctx, r.Context, r.IDs)
+	return presentResults(c.Presenter, rs, err)
+}
@@ -14,5 +14,9 @@ func (p *ProjectShowCmd) Run(c *Context) error {
 	if err != nil {
 		return fmt.Errorf("show project: %w", err)
 	}
-	return client.ShowProject(c.Ctx)
+	v, err := client.ShowProject(c.Ctx)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.Project(v)
 }
@@ -1,6 +1,11 @@
 package command
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	cli "github.com/threepipes/circleci-env"
+)
 
 type RmCmd struct {
 	Envs        []string `arg:"" optional:"" name:"env_name" help:"Environment variable names to remove."`
@@ -8,23 +13,22 @@ type RmCmd struct {
 }
 
 func (r *RmCmd) Run(c *Context) error {
+	if len(r.Envs) > 0 && r.Interactive {
+		return usageErrorf("do not specify both args `envs` and `-i, --interactive` in `rm` command")
+	}
+	if len(r.Envs) == 0 && !r.Interactive {
+		return usageErrorf("please specify at least one environment variable or set `-i`")
+	}
 	client, err := c.ClientGenerator()
 	if err != nil {
 		return fmt.Errorf("rm command: %w", err)
 	}
-	if len(r.Envs) > 0 && r.Interactive {
-		fmt.Println("InvalidArgumentError: Do not specify both args `envs` and `-i, --interactive` in `rm` command.")
-		return nil
-	}
 	if r.Interactive {
-		return client.DeleteVariablesInteractive(c.Ctx)
-	} else {
-		if len(r.Envs) == 0 {
-			fmt.Println("InvalidArgumentError: Please specify at least one environment variable or set `-i`.")
-			return nil
-		}
-		return client.DeleteVariables(c.Ctx, r.Envs)
+		rs, err := client.DeleteVariablesInteractive(c.Ctx)
+		return presentResults(c.Presenter, rs, err)
 	}
+	rs, err := client.DeleteVariables(c.Ctx, r.Envs)
+	return presentResults(c.Presenter, rs, err)
 }
 
 type LsCmd struct {
@@ -35,11 +39,14 @@ func (l *LsCmd) Run(c *Context) error {
 	if err != nil {
 		return fmt.Errorf("ls command: %w", err)
 	}
-	return client.ListVariables(c.Ctx)
+	vs, err := client.ListVariables(c.Ctx)
+	if err != nil {
+		return err
+	}
+	return c.Presenter.Variables(vs)
 }
 
 type AddCmd struct {
-	// TODO: force update flag
 	Name  string `arg:"" name:"name" help:"An environment variable name to be added."`
 	Value string `arg:"" name:"value" help:"An environment variable value to be added."`
 }
@@ -49,13 +56,13 @@ func (l *AddCmd) Run(c *Context) error {
 	if err != nil {
 		return fmt.Errorf("add command: %w", err)
 	}
-	return client.UpdateOrCreateVariable(c.Ctx, l.Name, l.Value)
+	r, err := client.UpdateOrCreateVariable(c.Ctx, l.Name, l.Value)
+	return presentResult(c.Presenter, r, err)
 }
 
 type AddFromInputCmd struct {
-	// TODO: force update flag
 	File string `name:"file" short:"f" help:"A file path containing environmental variables to be added. If this flag is not specified, stdin will be used."`
-	Type string `name:"type" short:"t" help:"Type(Format) of input. [dotenv|json] (default: dotenv)"`
+	Type string `name:"type" short:"t" help:"Type(Format) of input. [dotenv|json|yaml|toml|shell|age|sops] (default: detected from the extension or the content)"`
 }
 
 // type formatTypeFlag string
@@ -78,6 +85,32 @@ func (a *AddFromInputCmd) Help() string {
 	    "value": "bbb"
 	  }
 	]
+	or
+	{"TEST_ENV_1": "aaa", "TEST_ENV_2": "bbb"}
+
+	[yaml]
+	TEST_ENV_1: aaa
+	TEST_ENV_2: bbb
+
+	[toml]
+	TEST_ENV_1 = "aaa"
+	[TEST]
+	ENV_2 = "bbb"
+
+	[shell]
+	export TEST_ENV_1=aaa
+	export TEST_ENV_2='bbb'
+
+	Keys of nested maps and TOML sections are joined with "_" (e.g. TEST_ENV_2).
+	If -t is omitted, the format is detected from the extension of the file or the content.
+
+	[age]
+	A file in the formats above encrypted by age. (e.g. age -r <recipient> -o .env.age .env)
+
+	[sops]
+	A yaml, json or dotenv file encrypted by sops with age. Only flat maps are supported. The MAC of the file is verified.
+
+	Encrypted files are decrypted in memory with the age identities in --age-key-file.
 	`
 }
 
@@ -86,5 +119,107 @@ func (l *AddFromInputCmd) Run(c *Context) error {
 	if err != nil {
 		return fmt.Errorf("adds command: %w", err)
 	}
-	return client.UpdateOrCreateVariablesFromFile(c.Ctx, l.File, string(l.Type))
+	rs, err := client.UpdateOrCreateVariablesFromFile(c.Ctx, l.File, string(l.Type))
+	return presentResults(c.Presenter, rs, err)
+}
+
+type SyncCmd struct {
+	File string `name:"file" short:"f" help:"A file path containing all the environmental variables of the project. If this flag is not specified, stdin will be used."`
+	Type string `name:"type" short:"t" help:"Type(Format) of input. [dotenv|json|yaml|toml|shell|age|sops] (default: detected from the extension or the content)"`
+}
+
+func (s *SyncCmd) Help() string {
+	return `
+	Make the project's environment variables match the input exactly.
+	Variables which are not in the input will be removed.
+	The input format is the same as the one of addi command.
+	`
+}
+
+func (s *SyncCmd) Run(c *Context) error {
+	client, err := c.ClientGenerator()
+	if err != nil {
+		return fmt.Errorf("sync command: %w", err)
+	}
+	rs, err := client.SyncVariablesFromFile(c.Ctx, s.File, s.Type)
+	return presentResults(c.Presenter, rs, err)
+}
+
+type DiffCmd struct {
+	File string `name:"file" short:"f" help:"A file path containing environmental variables to be compared. If this flag is not specified, stdin will be used."`
+	Type string `name:"type" short:"t" help:"Type(Format) of input. [dotenv|json|yaml|toml|shell|age|sops] (default: detected from the extension or the content)"`
+}
+
+func (d *DiffCmd) Help() string {
+	return `
+	Show differences between the input and the project's environment variables.
+	Since CircleCI returns only masked values, variables on both sides are compared by their last 4 characters.
+	Exit with non-zero status if there are any differences.
+	`
+}
+
+func (d *DiffCmd) Run(c *Context) error {
+	client, err := c.ClientGenerator()
+	if err != nil {
+		return fmt.Errorf("diff command: %w", err)
+	}
+	rs, err := client.DiffVariablesFromFile(c.Ctx, d.File, d.Type)
+	if err != nil {
+		return err
+	}
+	if err := c.Presenter.Diff(rs); err != nil {
+		return err
+	}
+	if cli.HasDifference(rs) {
+		return cli.ErrVariablesDiffer
+	}
+	return nil
+}
+
+type CpCmd struct {
+	From  string   `name:"from" required:"" help:"A source repository. [<org>/<repo>|<repo>]"`
+	To    string   `name:"to" required:"" help:"A destination repository. [<org>/<repo>|<repo>]"`
+	Names []string `arg:"" optional:"" name:"env_name" help:"Environment variable names to copy. If not specified, all the variables are copied."`
+	File  string   `name:"file" short:"f" help:"A file path containing the values of the copied variables. Values not in the file are asked by prompts."`
+	Type  string   `name:"type" short:"t" help:"Type(Format) of the file. [dotenv|json|yaml|toml|shell|age|sops] (default: detected from the extension or the content)"`
+}
+
+func (cp *CpCmd) Help() string {
+	return `
+	Since CircleCI returns only masked values, the real values are read from the file specified by -f or prompts.
+	If <org> is omitted, the default organization is used.
+	`
+}
+
+// splitRepo splits `<org>/<repo>` into org and repo. org is empty if it is omitted.
+func splitRepo(s string) (string, string, error) {
+	sp := strings.Split(s, "/")
+	switch {
+	case len(sp) == 1 && sp[0] != "":
+		return "", sp[0], nil
+	case len(sp) == 2 && sp[0] != "" && sp[1] != "":
+		return sp[0], sp[1], nil
+	}
+	return "", "", usageErrorf("invalid repository: %s", s)
+}
+
+func (cp *CpCmd) Run(c *Context) error {
+	srcOrg, srcRepo, err := splitRepo(cp.From)
+	if err != nil {
+		return fmt.Errorf("cp command: %w", err)
+	}
+	dstOrg, dstRepo, err := splitRepo(cp.To)
+	if err != nil {
+		return fmt.Errorf("cp command: %w", err)
+	}
+	src, err := c.ProjectClientGenerator(srcOrg, srcRepo)
+	if err != nil {
+		return fmt.Errorf("cp command: %w", err)
+	}
+	dst, err := c.ProjectClientGenerator(dstOrg, dstRepo)
+	if err != nil {
+		return fmt.Errorf("cp command: %w", err)
+	}
+	rs, err := dst.CopyVariablesFrom(c.Ctx, src, cp.Names, cp.File, cp.Type)
+	return presentResults(c.Presenter, rs, err)
 }
@@ -3,18 +3,310 @@ package cli
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/adrg/xdg"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// Config is the settings of a profile
+// Fields tagged with `env` can be overridden by the environment variables
 type Config struct {
-	ApiToken         string `split_words:"true"`
-	OrganizationName string `split_words:"true"`
+	ApiToken         string `json:",omitempty" env:"CCIENV_API_TOKEN"`
+	OrganizationName string `json:",omitempty" env:"CCIENV_ORGANIZATION_NAME"`
+	// Host is the URL of CircleCI Server (e.g. https://circleci.example.com). circleci.com is used if it is empty.
+	Host string `json:",omitempty" env:"CCIENV_HOST"`
+	// CACert is the path of a PEM file of CA certificates trusted in addition to the system ones
+	CACert string `json:",omitempty" env:"CCIENV_CA_CERT"`
+	// Proxy is the URL of an HTTP proxy. HTTPS_PROXY and the like are used if it is empty.
+	Proxy string `json:",omitempty" env:"CCIENV_PROXY"`
+}
+
+// WithEnv returns a copy of c overridden by the environment variables which are not empty
+func (c *Config) WithEnv() *Config {
+	cp := *c
+	rv := reflect.ValueOf(&cp).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Tag.Get("env")
+		if name == "" || rv.Field(i).Kind() != reflect.String {
+			continue
+		}
+		if val := os.Getenv(name); val != "" {
+			rv.Field(i).SetString(val)
+		}
+	}
+	return &cp
+}
+
+// DefaultProfileName is the name of the profile written at the top level of the config file
+const DefaultProfileName = "default"
+
+// ErrNoConfig is returned when neither the config file nor the environment variables give the settings
+var ErrNoConfig = errors.New("no settings found. Please execute `ccienv config init` or set CCIENV_API_TOKEN")
+
+// ConfigFile is the content of the config file
+// The top level settings are used as the profile named `default`
+// Profile names are case-insensitive
+// If CredentialStore is set other than `file`, the API tokens are kept in the credential store instead of the file
+type ConfigFile struct {
+	Config           `mapstructure:",squash"`
+	DefaultProfile   string             `json:",omitempty"`
+	CredentialStore  string             `json:",omitempty"`
+	CredentialHelper string             `json:",omitempty"`
+	Remote           string             `json:",omitempty"`
+	Profiles         map[string]*Config `json:",omitempty"`
+}
+
+// Profile returns the settings of the profile
+// If name is empty, the default profile is returned
+func (f *ConfigFile) Profile(name string) (*Config, error) {
+	name = f.profileName(name)
+	if p, prs := f.Profiles[name]; prs {
+		return p, nil
+	}
+	if name == "" || name == DefaultProfileName {
+		cp := f.Config
+		return &cp, nil
+	}
+	return nil, fmt.Errorf("profile %s is not found in the config", name)
+}
+
+// profileName returns the lowercased name of the profile
+// The default profile is returned if name is empty. The top level one is `default` or empty.
+func (f *ConfigFile) profileName(name string) string {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	return strings.ToLower(name)
+}
+
+// ProfileWithEnv returns the settings of the profile overridden by the environment variables
+// The API token is read from the credential store only if neither the file nor the environment variables give it.
+// The token is left empty if the credential store is not available, so that it can be given by the environment variables.
+func (f *ConfigFile) ProfileWithEnv(name string) (*Config, error) {
+	p, err := f.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	p = p.WithEnv()
+	if p.ApiToken == "" {
+		name = f.profileName(name)
+		if name == "" {
+			name = DefaultProfileName
+		}
+		p.ApiToken = f.credential(name)
+	}
+	return p, nil
+}
+
+// ProfileNameForOrg returns the name of the profile whose organization is org
+// The default profile is preferred if multiple profiles match. Otherwise the first one sorted by names is returned.
+func (f *ConfigFile) ProfileNameForOrg(org string) (string, bool) {
+	if p, err := f.Profile(""); err == nil && strings.EqualFold(p.OrganizationName, org) {
+		return f.profileName(""), true
+	}
+	if f.Config != (Config{}) && strings.EqualFold(f.OrganizationName, org) {
+		return DefaultProfileName, true
+	}
+	for _, name := range f.ProfileNames() {
+		if p := f.Profiles[name]; strings.EqualFold(p.OrganizationName, org) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ProfileNames returns the sorted names of the profiles except for the top level one
+func (f *ConfigFile) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetProfile adds or replaces the profile
+// If name is empty or `default`, the top level settings are replaced
+func (f *ConfigFile) SetProfile(name string, cfg *Config) {
+	name = strings.ToLower(name)
+	if name == "" || name == DefaultProfileName {
+		f.Config = *cfg
+		return
+	}
+	if f.Profiles == nil {
+		f.Profiles = make(map[string]*Config)
+	}
+	f.Profiles[name] = cfg
+}
+
+// Keys of the settings which can be read and written by ConfigFile.Get and ConfigFile.Set
+// The keys up to ConfigKeyProxy are settings of a profile and the others are settings of the whole file
+const (
+	ConfigKeyApiToken         = "apitoken"
+	ConfigKeyOrganizationName = "organizationname"
+	ConfigKeyHost             = "host"
+	ConfigKeyCACert           = "cacert"
+	ConfigKeyProxy            = "proxy"
+	ConfigKeyDefaultProfile   = "defaultprofile"
+	ConfigKeyCredentialStore  = "credentialstore"
+	ConfigKeyCredentialHelper = "credentialhelper"
+	ConfigKeyRemote           = "remote"
+)
+
+// ConfigKeys is the list of the keys in the config file
+var ConfigKeys = []string{
+	ConfigKeyApiToken,
+	ConfigKeyOrganizationName,
+	ConfigKeyHost,
+	ConfigKeyCACert,
+	ConfigKeyProxy,
+	ConfigKeyDefaultProfile,
+	ConfigKeyCredentialStore,
+	ConfigKeyCredentialHelper,
+	ConfigKeyRemote,
+}
+
+// profileSetting returns the pointer to the setting of a profile, or nil if key is not a setting of a profile
+func profileSetting(cfg *Config, key string) *string {
+	switch key {
+	case ConfigKeyApiToken:
+		return &cfg.ApiToken
+	case ConfigKeyOrganizationName:
+		return &cfg.OrganizationName
+	case ConfigKeyHost:
+		return &cfg.Host
+	case ConfigKeyCACert:
+		return &cfg.CACert
+	case ConfigKeyProxy:
+		return &cfg.Proxy
+	}
+	return nil
+}
+
+// fileSetting returns the pointer to the setting of the whole file, or nil if key is a setting of a profile
+func (f *ConfigFile) fileSetting(key string) *string {
+	switch key {
+	case ConfigKeyDefaultProfile:
+		return &f.DefaultProfile
+	case ConfigKeyCredentialStore:
+		return &f.CredentialStore
+	case ConfigKeyCredentialHelper:
+		return &f.CredentialHelper
+	case ConfigKeyRemote:
+		return &f.Remote
+	}
+	return nil
+}
+
+// ErrUnknownConfigKey is returned when a key is not in ConfigKeys
+var ErrUnknownConfigKey = errors.New("unknown config key")
+
+func profileOrDefault(name string) string {
+	if name == "" {
+		return DefaultProfileName
+	}
+	return name
+}
+
+// Get returns the value of key in the profile
+// If profile is empty, the top level settings are used in the same way as SetProfile
+func (f *ConfigFile) Get(profile string, key string) (string, error) {
+	key = strings.ToLower(key)
+	if v := f.fileSetting(key); v != nil {
+		return *v, nil
+	}
+	p, err := f.Profile(profileOrDefault(profile))
+	if err != nil {
+		return "", err
+	}
+	if v := profileSetting(p, key); v != nil {
+		return *v, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownConfigKey, key)
+}
+
+// Set sets the value of key in the profile
+// The profile is created if it does not exist
+func (f *ConfigFile) Set(profile string, key string, value string) error {
+	key = strings.ToLower(key)
+	switch key {
+	case ConfigKeyDefaultProfile:
+		value = strings.ToLower(value)
+	case ConfigKeyCredentialStore:
+		if _, prs := credentialStores[value]; !prs && value != CredentialStoreFile {
+			return fmt.Errorf("unknown credential store: %s", value)
+		}
+	}
+	if v := f.fileSetting(key); v != nil {
+		*v = value
+		return nil
+	}
+	cfg := Config{}
+	if p, err := f.Profile(profileOrDefault(profile)); err == nil {
+		cfg = *p
+	}
+	v := profileSetting(&cfg, key)
+	if v == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownConfigKey, key)
+	}
+	*v = value
+	f.SetProfile(profile, &cfg)
+	return nil
+}
+
+// ConfigEntryRecord is a setting in the config file
+// Profile is empty for the settings of the whole file
+type ConfigEntryRecord struct {
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Key     string `json:"key" yaml:"key"`
+	Value   string `json:"value" yaml:"value"`
+}
+
+// Entries returns all the settings in the config file. The API tokens are masked.
+func (f *ConfigFile) Entries() []*ConfigEntryRecord {
+	profileEntries := func(name string, p *Config) []*ConfigEntryRecord {
+		token := p.ApiToken
+		if token != "" {
+			token = maskValue(token)
+		}
+		rs := []*ConfigEntryRecord{
+			{Profile: name, Key: ConfigKeyApiToken, Value: token},
+			{Profile: name, Key: ConfigKeyOrganizationName, Value: p.OrganizationName},
+		}
+		// The settings for CircleCI Server are listed only if they are set
+		for _, key := range []string{ConfigKeyHost, ConfigKeyCACert, ConfigKeyProxy} {
+			if v := *profileSetting(p, key); v != "" {
+				rs = append(rs, &ConfigEntryRecord{Profile: name, Key: key, Value: v})
+			}
+		}
+		return rs
+	}
+	var rs []*ConfigEntryRecord
+	for _, key := range []string{ConfigKeyDefaultProfile, ConfigKeyCredentialStore, ConfigKeyCredentialHelper, ConfigKeyRemote} {
+		if v := *f.fileSetting(key); v != "" {
+			rs = append(rs, &ConfigEntryRecord{Key: key, Value: v})
+		}
+	}
+	if f.Config != (Config{}) {
+		rs = append(rs, profileEntries(DefaultProfileName, &f.Config)...)
+	}
+	for _, name := range f.ProfileNames() {
+		rs = append(rs, profileEntries(name, f.Profiles[name])...)
+	}
+	return rs
+}
+
+// ConfigPath returns the path of the config file
+func ConfigPath() (string, error) {
+	return getConfigPath()
 }
 
 func getConfigPath() (string, error) {
@@ -22,50 +314,113 @@ func getConfigPath() (string, error) {
 	return dir + "/ccienv/config.yml", nil
 }
 
-func ReadConfig() (*Config, error) {
+// ReadConfigFile reads all the profiles from the config file
+// The API tokens in the credential store are not read. Use ProfileWithEnv to read the token of a profile.
+// ErrNoConfig is returned if the config file does not exist
+func ReadConfigFile() (*ConfigFile, error) {
 	cp, err := getConfigPath()
 	cp = filepath.Dir(cp)
 	if err != nil {
 		return nil, err
 	}
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(cp)
-	if err := viper.ReadInConfig(); err != nil {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.AddConfigPath(cp)
+	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			logrus.Errorln("No config is found. Please execute `ccienv config init`")
-			return nil, fmt.Errorf("no settings found")
+			return nil, ErrNoConfig
 		} else {
 			return nil, fmt.Errorf("read config from a config file: %w", err)
 		}
 	}
-	var c Config
-	if err := viper.Unmarshal(&c); err != nil {
+	var f ConfigFile
+	if err := v.Unmarshal(&f); err != nil {
 		return nil, fmt.Errorf("read config from a config file: %w", err)
 	}
-	return &c, nil
+	return &f, nil
 }
 
-func WriteConfig(conf *Config) error {
+// ReadConfigFileOrEmpty is the same as ReadConfigFile except that an empty config is returned if the file does not exist
+func ReadConfigFileOrEmpty() (*ConfigFile, error) {
+	f, err := ReadConfigFile()
+	if errors.Is(err, ErrNoConfig) {
+		return &ConfigFile{}, nil
+	}
+	return f, err
+}
+
+// ReadConfig reads the default profile overridden by the environment variables
+// The config file is not required if the environment variables give the settings
+func ReadConfig() (*Config, error) {
+	f, err := ReadConfigFileOrEmpty()
+	if err != nil {
+		return nil, err
+	}
+	p, err := f.ProfileWithEnv("")
+	if err != nil {
+		return nil, err
+	}
+	return p.Validate()
+}
+
+// Validate returns c itself if c has the required settings
+func (c *Config) Validate() (*Config, error) {
+	if c.ApiToken == "" {
+		return nil, ErrNoConfig
+	}
+	return c, nil
+}
+
+// WriteConfigFile writes all the profiles to the config file
+// The API tokens are written to the credential store if it is set
+// The config file is readable only by the owner since it may contain the tokens
+func WriteConfigFile(f *ConfigFile) error {
 	cp, err := getConfigPath()
 	if err != nil {
 		return err
 	}
-	bt, err := json.Marshal(&conf)
+	f, err = f.storeCredentials()
 	if err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
-	viper.SetConfigType("json")
-	if err := viper.ReadConfig(bytes.NewBuffer(bt)); err != nil {
+	bt, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	v := viper.New()
+	v.SetConfigType("json")
+	if err := v.ReadConfig(bytes.NewBuffer(bt)); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
 
-	viper.SetConfigType("yaml")
+	v.SetConfigType("yaml")
+	v.SetConfigPermissions(0600)
 	dirpath := filepath.Dir(cp)
-	if err := os.MkdirAll(dirpath, os.ModePerm); err != nil {
+	if err := os.MkdirAll(dirpath, 0700); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
-	if err := viper.WriteConfigAs(cp); err != nil {
+	if err := v.WriteConfigAs(cp); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	// The permissions of an existing file are not changed by WriteConfigAs
+	if err := os.Chmod(cp, 0600); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
 	return nil
 }
+
+// WriteConfig writes conf as the profile named `default`
+// The other profiles in the config file are kept
+func WriteConfig(conf *Config) error {
+	return WriteProfile(DefaultProfileName, conf)
+}
+
+// WriteProfile adds or replaces a profile in the config file
+func WriteProfile(name string, conf *Config) error {
+	f, err := ReadConfigFileOrEmpty()
+	if err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	f.SetProfile(name, conf)
+	return WriteConfigFile(f)
+}
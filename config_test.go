@@ -51,6 +51,36 @@ func TestReadConfig(t *testing.T) {
 	}
 }
 
+func TestReadConfig_Env(t *testing.T) {
+	cleaner, err := prepareConfigPath()
+	if err != nil {
+		t.Errorf("Failed to prepare: %v", err)
+	}
+	defer cleaner()
+
+	_, err = ReadConfig()
+	assert.ErrorIs(t, err, ErrNoConfig)
+
+	// No config file is required
+	t.Setenv("CCIENV_API_TOKEN", "envtoken")
+	t.Setenv("CCIENV_ORGANIZATION_NAME", "")
+	got, err := ReadConfig()
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, &Config{ApiToken: "envtoken"}, got)
+
+	// The environment variables take precedence over the config file
+	if err := prepareConfig("apitoken: abc\norganizationname: cde\n"); err != nil {
+		t.Errorf("Failed to prepare a config file: %v", err)
+	}
+	got, err = ReadConfig()
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, &Config{ApiToken: "envtoken", OrganizationName: "cde"}, got)
+}
+
 func TestWriteConfig(t *testing.T) {
 	cleaner, err := prepareConfigPath()
 	if err != nil {
@@ -75,3 +105,123 @@ func TestWriteConfig(t *testing.T) {
 	}
 	assert.Equal(t, expected, string(dat))
 }
+
+func TestReadConfigFile_Profiles(t *testing.T) {
+	cleaner, err := prepareConfigPath()
+	if err != nil {
+		t.Errorf("Failed to prepare: %v", err)
+	}
+	defer cleaner()
+	data := `apitoken: abc
+organizationname: cde
+defaultprofile: work
+profiles:
+  work:
+    apitoken: tkn1
+    organizationname: org1
+  oss:
+    apitoken: tkn2
+    organizationname: org2
+`
+	if err := prepareConfig(data); err != nil {
+		t.Errorf("Failed to prepare a config file: %v", err)
+	}
+	f, err := ReadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{ApiToken: "tkn1", OrganizationName: "org1"}, got)
+
+	got, err = f.Profile("default")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{ApiToken: "abc", OrganizationName: "cde"}, got)
+
+	_, err = f.Profile("unknown")
+	assert.Error(t, err)
+
+	name, ok := f.ProfileNameForOrg("ORG2")
+	assert.True(t, ok)
+	assert.Equal(t, "oss", name)
+
+	name, ok = f.ProfileNameForOrg("cde")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultProfileName, name)
+
+	_, ok = f.ProfileNameForOrg("unknown")
+	assert.False(t, ok)
+
+	got, err = ReadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{ApiToken: "tkn1", OrganizationName: "org1"}, got)
+}
+
+func TestWriteProfile(t *testing.T) {
+	cleaner, err := prepareConfigPath()
+	if err != nil {
+		t.Errorf("Failed to prepare: %v", err)
+	}
+	defer cleaner()
+	if err := WriteConfig(&Config{ApiToken: "efg", OrganizationName: "ghi"}); err != nil {
+		t.Error(err)
+	}
+	if err := WriteProfile("Work", &Config{ApiToken: "tkn1", OrganizationName: "org1"}); err != nil {
+		t.Error(err)
+	}
+	f, err := ReadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &ConfigFile{
+		Config: Config{ApiToken: "efg", OrganizationName: "ghi"},
+		Profiles: map[string]*Config{
+			"work": {ApiToken: "tkn1", OrganizationName: "org1"},
+		},
+	}, f)
+}
+
+func TestConfigFile_GetSet(t *testing.T) {
+	f := &ConfigFile{Config: Config{ApiToken: "abc", OrganizationName: "cde"}}
+
+	if err := f.Set("Work", "apitoken", "tkn12345"); err != nil {
+		t.Error(err)
+	}
+	if err := f.Set("work", "OrganizationName", "org1"); err != nil {
+		t.Error(err)
+	}
+	if err := f.Set("", "defaultprofile", "Work"); err != nil {
+		t.Error(err)
+	}
+	if err := f.Set("", "organizationname", "new"); err != nil {
+		t.Error(err)
+	}
+	assert.ErrorIs(t, f.Set("", "unknown", "x"), ErrUnknownConfigKey)
+
+	assert.Equal(t, &ConfigFile{
+		Config:         Config{ApiToken: "abc", OrganizationName: "new"},
+		DefaultProfile: "work",
+		Profiles: map[string]*Config{
+			"work": {ApiToken: "tkn12345", OrganizationName: "org1"},
+		},
+	}, f)
+
+	v, err := f.Get("work", "apitoken")
+	assert.NoError(t, err)
+	assert.Equal(t, "tkn12345", v)
+	// The top level settings are used without a profile even if the default profile is set
+	v, err = f.Get("", "organizationname")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", v)
+	_, err = f.Get("unknown", "apitoken")
+	assert.Error(t, err)
+
+	assert.Equal(t, []*ConfigEntryRecord{
+		{Key: "defaultprofile", Value: "work"},
+		{Profile: "default", Key: "apitoken", Value: "xxxxabc"},
+		{Profile: "default", Key: "organizationname", Value: "new"},
+		{Profile: "work", Key: "apitoken", Value: "xxxx2345"},
+		{Profile: "work", Key: "organizationname", Value: "org1"},
+	}, f.Entries())
+}
@@ -0,0 +1,429 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/grezar/go-circleci"
+)
+
+// ContextClient manages CircleCI contexts of an organization
+type ContextClient struct {
+	ci        *circleci.Client
+	ownerSlug string
+	ui        UI
+	opts      Options
+	reporter
+	audit *auditLogger
+
+	token      string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewContextClient(cfg *Config, ownerSlug string, opts Options) (*ContextClient, error) {
+	ci, hc, err := newCircleCIClient(cfg, opts.MaxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("new context client: %w", err)
+	}
+	return &ContextClient{
+		ci:         ci,
+		ownerSlug:  ownerSlug,
+		ui:         newUI(opts),
+		opts:       opts,
+		reporter:   newReporter(opts.Messages),
+		audit:      newAuditLogger(opts.AuditLog, ci),
+		token:      cfg.ApiToken,
+		baseURL:    cfg.apiURL(),
+		httpClient: hc,
+	}, nil
+}
+
+func (c *ContextClient) listAllContexts(ctx context.Context) ([]*circleci.Context, error) {
+	cs, err := listAllPages(ctx, func(ctx context.Context, token *string) ([]*circleci.Context, string, error) {
+		opts := circleci.ContextListOptions{
+			OwnerSlug: &c.ownerSlug,
+			PageToken: token,
+		}
+		cl, err := c.ci.Contexts.List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return cl.Items, cl.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing all contexts: %w", err)
+	}
+	return cs, nil
+}
+
+func (c *ContextClient) getContextByName(ctx context.Context, name string) (*circleci.Context, error) {
+	cs, err := c.listAllContexts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cx := range cs {
+		if cx.Name == name {
+			return cx, nil
+		}
+	}
+	return nil, fmt.Errorf("context %s is not found in %s", name, c.ownerSlug)
+}
+
+func (c *ContextClient) listAllContextVariables(ctx context.Context, contextID string) ([]*circleci.ContextVariable, error) {
+	cvs, err := listAllPages(ctx, func(ctx context.Context, token *string) ([]*circleci.ContextVariable, string, error) {
+		opts := circleci.ContextListVariablesOptions{PageToken: token}
+		cl, err := c.ci.Contexts.ListVariables(ctx, contextID, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return cl.Items, cl.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing all context variables: %w", err)
+	}
+	return cvs, nil
+}
+
+func getMaxContextVariableLength(cvs []*circleci.ContextVariable) int {
+	maxlen := 0
+	for _, v := range cvs {
+		if len(v.Variable) > maxlen {
+			maxlen = len(v.Variable)
+		}
+	}
+	return maxlen
+}
+
+func dumpContextVariables(w io.Writer, cvs []*circleci.ContextVariable) {
+	maxlen := getMaxContextVariableLength(cvs)
+	for _, v := range cvs {
+		fmt.Fprintf(w, "%-*s %s\n", maxlen, v.Variable, v.UpdatedAt.Format(time.RFC3339))
+	}
+}
+
+func convertContextVariablesToString(cvs []*circleci.ContextVariable) []string {
+	maxlen := getMaxContextVariableLength(cvs)
+	res := make([]string, len(cvs))
+	for i, v := range cvs {
+		res[i] = fmt.Sprintf("%-*s %s", maxlen, v.Variable, v.UpdatedAt.Format(time.RFC3339))
+	}
+	return res
+}
+
+// ContextRecord is a context of the organization
+type ContextRecord struct {
+	ID        string `json:"id" yaml:"id"`
+	Name      string `json:"name" yaml:"name"`
+	CreatedAt string `json:"created_at" yaml:"created_at"`
+}
+
+// ContextVariableRecord is a variable of a context. The values are not available in the API.
+type ContextVariableRecord struct {
+	Name      string `json:"name" yaml:"name"`
+	CreatedAt string `json:"created_at" yaml:"created_at"`
+	UpdatedAt string `json:"updated_at" yaml:"updated_at"`
+}
+
+// ContextDetailRecord is a context with its variables
+type ContextDetailRecord struct {
+	ContextRecord `yaml:",inline"`
+	Variables     []*ContextVariableRecord `json:"variables" yaml:"variables"`
+}
+
+func toContextRecords(cs []*circleci.Context) []*ContextRecord {
+	rs := make([]*ContextRecord, len(cs))
+	for i, cx := range cs {
+		rs[i] = &ContextRecord{
+			ID:        cx.ID,
+			Name:      cx.Name,
+			CreatedAt: cx.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	return rs
+}
+
+func toContextVariableRecords(cvs []*circleci.ContextVariable) []*ContextVariableRecord {
+	rs := make([]*ContextVariableRecord, len(cvs))
+	for i, v := range cvs {
+		rs[i] = &ContextVariableRecord{
+			Name:      v.Variable,
+			CreatedAt: v.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: v.UpdatedAt.Format(time.RFC3339),
+		}
+	}
+	return rs
+}
+
+func (c *ContextClient) ListContexts(ctx context.Context) ([]*ContextRecord, error) {
+	cs, err := c.listAllContexts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list contexts: %w", err)
+	}
+	return toContextRecords(cs), nil
+}
+
+func (c *ContextClient) CreateContext(ctx context.Context, name string) (*ResultRecord, error) {
+	if c.opts.DryRun {
+		return c.planned("create", name), nil
+	}
+	ownerType := circleci.OwnerTypeOrganization
+	cx, err := c.ci.Contexts.Create(ctx, circleci.ContextCreateOptions{
+		Name: &name,
+		Owner: &circleci.OwnerOptions{
+			Slug: &c.ownerSlug,
+			Type: &ownerType,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create context: %w", err)
+	}
+	c.printf("Created: %s (%s)\n", cx.Name, cx.ID)
+	return newResultRecord(cx.Name, "create", nil), nil
+}
+
+// DeleteContext deletes a context with its variables
+// ErrCancelled is returned if the user cancelled
+func (c *ContextClient) DeleteContext(ctx context.Context, name string) (*ResultRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("delete context: %w", err)
+	}
+	cvs, err := c.listAllContextVariables(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("delete context: %w", err)
+	}
+
+	c.printf("Context %s (%s) will be removed with %d variables.\n", cx.Name, cx.ID, len(cvs))
+	c.println()
+	yes, err := c.ui.YesNo("Do you want to continue?")
+	if err != nil {
+		return nil, fmt.Errorf("delete context: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+	if c.opts.DryRun {
+		return c.planned("delete", cx.Name), nil
+	}
+	err = c.ci.Contexts.Delete(ctx, cx.ID)
+	// The variables are deleted with the context, so each of them is recorded
+	ops := make([]*operation, len(cvs))
+	rs := make([]*ResultRecord, len(cvs))
+	for i, v := range cvs {
+		ops[i] = &operation{kind: "delete", name: v.Variable}
+		rs[i] = newResultRecord(v.Variable, "delete", err)
+	}
+	c.audit.recordOperations(ctx, "", cx.Name, ops, rs)
+	if err != nil {
+		return nil, fmt.Errorf("delete context: %w", err)
+	}
+	c.printf("Deleted: %s\n", cx.Name)
+	return newResultRecord(cx.Name, "delete", nil), nil
+}
+
+func (c *ContextClient) ShowContext(ctx context.Context, name string) (*ContextDetailRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("show context: %w", err)
+	}
+	cvs, err := c.listAllContextVariables(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("show context: %w", err)
+	}
+	return &ContextDetailRecord{
+		ContextRecord: *toContextRecords([]*circleci.Context{cx})[0],
+		Variables:     toContextVariableRecords(cvs),
+	}, nil
+}
+
+func (c *ContextClient) ListContextVariables(ctx context.Context, name string) ([]*ContextVariableRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("list context vars: %w", err)
+	}
+	cvs, err := c.listAllContextVariables(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list context vars: %w", err)
+	}
+	return toContextVariableRecords(cvs), nil
+}
+
+// UpdateOrCreateContextVariable creates or updates a variable of a context
+// ErrCancelled is returned if the user cancelled
+func (c *ContextClient) UpdateOrCreateContextVariable(ctx context.Context, name string, key string, val string) (*ResultRecord, error) {
+	rs, err := c.updateOrCreateContextVariables(ctx, name, []*circleci.ProjectVariable{{Name: key, Value: val}})
+	if len(rs) == 0 {
+		return nil, err
+	}
+	return rs[0], err
+}
+
+// UpdateOrCreateContextVariablesFromFile updates variables of a context by reading a file or stdin
+// If the path is empty, stdin will be used as input
+func (c *ContextClient) UpdateOrCreateContextVariablesFromFile(ctx context.Context, name string, path string, filetype string) ([]*ResultRecord, error) {
+	pvs, err := readVariables(c.ui, c.opts.AgeKeyFile, path, filetype)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateOrCreateContextVariables(ctx, name, pvs)
+}
+
+func (c *ContextClient) updateOrCreateContextVariables(ctx context.Context, name string, pvs []*circleci.ProjectVariable) ([]*ResultRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("update or create context vars: %w", err)
+	}
+	cvs, err := c.listAllContextVariables(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("update or create context vars: %w", err)
+	}
+	mp := make(map[string]*circleci.ContextVariable)
+	for _, v := range cvs {
+		mp[v.Variable] = v
+	}
+	overwrittens := make([]*circleci.ContextVariable, 0)
+	news := make([]*circleci.ProjectVariable, 0)
+	for _, pv := range pvs {
+		if v, prs := mp[pv.Name]; prs {
+			overwrittens = append(overwrittens, v)
+		} else {
+			news = append(news, pv)
+		}
+	}
+	skipped := make([]*ResultRecord, 0)
+	if len(overwrittens) > 0 && c.opts.NoOverwrite {
+		c.println("These values already exist and are skipped.")
+		c.println()
+		dumpContextVariables(c.info(), overwrittens)
+		c.println()
+		for _, v := range overwrittens {
+			skipped = append(skipped, &ResultRecord{Name: v.Variable, Operation: "create", Result: ResultSkipped})
+		}
+		pvs = news
+	} else if len(overwrittens) > 0 {
+		c.println("These values are already exist.")
+		c.println()
+		dumpContextVariables(c.info(), overwrittens)
+		c.println()
+		yes, err := c.ui.YesNo("Do you want to update all the variables?")
+		if err != nil {
+			return nil, err
+		}
+		if !yes {
+			c.println("Cancelled.")
+			return nil, ErrCancelled
+		}
+	}
+	ops := make([]*operation, len(pvs))
+	for i, pv := range pvs {
+		pv := pv
+		ops[i] = &operation{kind: "create", name: pv.Name, value: pv.Value, call: func(ctx context.Context) error {
+			_, err := c.ci.Contexts.AddOrUpdateVariable(ctx, cx.ID, pv.Name, circleci.ContextAddOrUpdateVariableOptions{
+				Value: &pv.Value,
+			})
+			return err
+		}}
+	}
+	rs := executeOperations(ctx, c.opts, &c.reporter, ops)
+	c.audit.recordOperations(ctx, "", cx.Name, ops, rs)
+	rs = append(rs, skipped...)
+	return rs, checkResults(rs)
+}
+
+func (c *ContextClient) deleteContextVariables(ctx context.Context, cx *circleci.Context, dels []*circleci.ContextVariable) ([]*ResultRecord, error) {
+	if len(dels) == 0 {
+		return nil, fmt.Errorf("no values are specified")
+	}
+
+	c.printf("These variables will be removed from %s.\n", cx.Name)
+	c.println()
+	dumpContextVariables(c.info(), dels)
+	c.println()
+
+	yes, err := c.ui.YesNo("Do you want to continue?")
+	if err != nil {
+		return nil, fmt.Errorf("delete context vars: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+
+	ops := make([]*operation, len(dels))
+	for i, v := range dels {
+		name := v.Variable
+		ops[i] = &operation{kind: "delete", name: name, call: func(ctx context.Context) error {
+			return c.ci.Contexts.RemoveVariable(ctx, cx.ID, name)
+		}}
+	}
+	rs := executeOperations(ctx, c.opts, &c.reporter, ops)
+	c.audit.recordOperations(ctx, "", cx.Name, ops, rs)
+	return rs, checkResults(rs)
+}
+
+func (c *ContextClient) DeleteContextVariablesInteractive(ctx context.Context, name string) ([]*ResultRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("delete context vars: %w", err)
+	}
+	cvs, err := c.listAllContextVariables(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("delete context vars: %w", err)
+	}
+	scv := convertContextVariablesToString(cvs)
+	sel, err := c.ui.SelectFromList("Choose variables to be deleted.", scv)
+	if err != nil {
+		return nil, fmt.Errorf("delete context vars: %w", err)
+	}
+
+	rrm := makeReverseResolutionMap(scv)
+	dels := make([]*circleci.ContextVariable, len(sel))
+	for i, s := range sel {
+		dels[i] = cvs[rrm[s]]
+	}
+
+	return c.deleteContextVariables(ctx, cx, dels)
+}
+
+// DeleteContextVariables deletes variables of a context by names
+// Variables not found are reported as skipped results
+func (c *ContextClient) DeleteContextVariables(ctx context.Context, name string, vars []string) ([]*ResultRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("delete context vars: %w", err)
+	}
+	cvs, err := c.listAllContextVariables(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("delete context vars: %w", err)
+	}
+
+	mp := make(map[string]*circleci.ContextVariable)
+	for _, v := range cvs {
+		mp[v.Variable] = v
+	}
+	dels := make([]*circleci.ContextVariable, 0)
+	nonDels := make([]string, 0)
+	for _, v := range vars {
+		if cv, prs := mp[v]; prs {
+			dels = append(dels, cv)
+		} else {
+			nonDels = append(nonDels, v)
+		}
+	}
+	dumpNames(c.info(), "These variables are not found.", nonDels)
+	skipped := notFoundRecords(nonDels, "delete")
+	if len(dels) == 0 {
+		c.println("There are no deleted variables.")
+		return skipped, nil
+	}
+	rs, err := c.deleteContextVariables(ctx, cx, dels)
+	if rs == nil {
+		return nil, err
+	}
+	return append(rs, skipped...), err
+}
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+const ownerSlug = "gh/testorg"
+const contextBaseURL = "https://circleci.com/api/v2/context"
+const testContextID = "00000000-0000-0000-0000-000000000001"
+
+func setupContextClient(t *testing.T, ui UI) *ContextClient {
+	contexts := []circleci.ContextList{
+		{
+			Items: []*circleci.Context{
+				{ID: "00000000-0000-0000-0000-000000000000", Name: "other", CreatedAt: time.Now()},
+			},
+			NextPageToken: "page2",
+		},
+		{
+			Items: []*circleci.Context{
+				{ID: testContextID, Name: "shared", CreatedAt: time.Now()},
+			},
+		},
+	}
+	httpmock.RegisterResponder("GET", contextBaseURL, func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, ownerSlug, r.URL.Query().Get("owner-slug"))
+		if r.URL.Query().Get("page-token") == "page2" {
+			return httpmock.NewJsonResponse(200, contexts[1])
+		}
+		return httpmock.NewJsonResponse(200, contexts[0])
+	})
+	vars := circleci.ContextVariableList{
+		Items: []*circleci.ContextVariable{
+			{Variable: "FOO", ContextID: testContextID},
+			{Variable: "BAR", ContextID: testContextID},
+			{Variable: "TEST_ENV_2", ContextID: testContextID},
+		},
+	}
+	resp, err := httpmock.NewJsonResponder(200, vars)
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", contextBaseURL+"/"+testContextID+"/environment-variable", resp)
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+	return &ContextClient{
+		ci:        ci,
+		ownerSlug: ownerSlug,
+		ui:        ui,
+	}
+}
+
+func TestContextClient_DeleteContextVariablesInteractive(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	expectedDeleteURL := contextBaseURL + "/" + testContextID + "/environment-variable/BAR"
+	httpmock.RegisterResponder("DELETE", expectedDeleteURL,
+		httpmock.NewStringResponder(200, `{"message":"OK"}`))
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	c := setupContextClient(t, ui)
+
+	ui.EXPECT().SelectFromList(gomock.Any(), gomock.Len(3)).DoAndReturn(func(msg string, ls []string) ([]string, error) {
+		return []string{ls[1]}, nil
+	})
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+
+	if _, err := c.DeleteContextVariablesInteractive(context.Background(), "shared"); err != nil {
+		t.Error(err)
+	}
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["DELETE "+expectedDeleteURL], "Expected number of delete API call is wrong")
+}
+
+func TestContextClient_DeleteContext(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("DELETE", contextBaseURL+"/"+testContextID,
+		httpmock.NewStringResponder(200, `{"message":"OK"}`))
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v2/me",
+		httpmock.NewStringResponder(200, `{"id":"uid","login":"octocat","name":"The Octocat"}`))
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+	c := setupContextClient(t, ui)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	c.audit = newAuditLogger(auditPath, c.ci)
+
+	if _, err := c.DeleteContext(context.Background(), "shared"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadAuditLog(auditPath, AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(got))
+	for i, e := range got {
+		assert.Equal(t, "shared", e.Context)
+		assert.Equal(t, "delete", e.Operation)
+		assert.Equal(t, ResultSucceeded, e.Result)
+		names[i] = e.Name
+	}
+	assert.Equal(t, []string{"FOO", "BAR", "TEST_ENV_2"}, names, "each variable of the context is recorded")
+}
+
+func TestContextClient_UpdateOrCreateContextVariablesFromFile(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	created := make(map[string]string)
+	httpmock.RegisterRegexpResponder("PUT", regexp.MustCompile(`^`+regexp.QuoteMeta(contextBaseURL+"/"+testContextID+"/environment-variable/")+`\w+$`),
+		func(r *http.Request) (*http.Response, error) {
+			var opts circleci.ContextAddOrUpdateVariableOptions
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+				return httpmock.NewStringResponse(500, err.Error()), nil
+			}
+			name := path.Base(r.URL.Path)
+			created[name] = *opts.Value
+			return httpmock.NewJsonResponse(200, circleci.ContextVariable{Variable: name, ContextID: testContextID})
+		})
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+	c := setupContextClient(t, ui)
+
+	if _, err := c.UpdateOrCreateContextVariablesFromFile(context.Background(), "shared", "fixtures/test.json", "json"); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, map[string]string{"TEST_ENV_1": "aaa", "TEST_ENV_2": "bbb"}, created)
+}
+
+func TestContextClient_getContextByName(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	c := setupContextClient(t, nil)
+	cx, err := c.getContextByName(context.Background(), "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testContextID, cx.ID)
+
+	_, err = c.getContextByName(context.Background(), "notfound")
+	assert.Error(t, err)
+}
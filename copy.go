@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grezar/go-circleci"
+)
+
+// fillValues replaces masked values of pvs with real ones
+// Values are taken from a file if the path is not empty, and the rest are read by prompts
+func (c *Client) fillValues(pvs []*circleci.ProjectVariable, path string, filetype string) ([]*circleci.ProjectVariable, error) {
+	known := make(map[string]*circleci.ProjectVariable)
+	if path != "" {
+		lvs, err := readVariables(c.ui, c.opts.AgeKeyFile, path, filetype)
+		if err != nil {
+			return nil, err
+		}
+		known = makeProjectVariableMap(lvs)
+	}
+
+	res := make([]*circleci.ProjectVariable, len(pvs))
+	for i, pv := range pvs {
+		if lv, prs := known[pv.Name]; prs {
+			res[i] = &circleci.ProjectVariable{Name: pv.Name, Value: lv.Value}
+			continue
+		}
+		val, err := c.ui.ReadSecret(fmt.Sprintf("Please input the value of %s (%s): ", pv.Name, pv.Value))
+		if err != nil {
+			return nil, err
+		}
+		res[i] = &circleci.ProjectVariable{Name: pv.Name, Value: val}
+	}
+	return res, nil
+}
+
+// CopyVariablesFrom copies variables of the src project to the project of this client
+// If names is empty, all the variables of the src project are copied
+// Since the API returns only masked values, the real values are read from a file (if the path is not empty) or prompts
+func (c *Client) CopyVariablesFrom(ctx context.Context, src *Client, names []string, path string, filetype string) ([]*ResultRecord, error) {
+	vs, err := src.listAllVariables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("copy vars: %w", err)
+	}
+
+	cps := vs
+	skipped := make([]*ResultRecord, 0)
+	if len(names) > 0 {
+		var nonCps []string
+		cps, nonCps = getFoundAndNotFoundVariables(names, vs)
+		if len(nonCps) > 0 {
+			dumpNames(c.info(), fmt.Sprintf("These variables are not found in %s.", src.projectSlug), nonCps)
+		}
+		skipped = notFoundRecords(nonCps, "create")
+	}
+	if len(cps) == 0 {
+		c.println("There are no copied variables.")
+		return skipped, nil
+	}
+
+	pvs, err := c.fillValues(cps, path, filetype)
+	if err != nil {
+		return nil, fmt.Errorf("copy vars: %w", err)
+	}
+
+	pvs, yes, err := c.confirmOverwrite(ctx, pvs)
+	if err != nil {
+		return nil, fmt.Errorf("copy vars: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+	// The result of each variable is written by createVariables
+	c.printf("Copying from %s to %s.\n", src.projectSlug, c.projectSlug)
+	rs := c.createVariables(ctx, pvs)
+	rs = append(rs, skipped...)
+	return rs, checkResults(rs)
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+func TestClient_CopyVariablesFrom(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	srcSlug := "gh/testorg/srcprj"
+	srcListURL := "https://circleci.com/api/v2/project/" + srcSlug + "/envvar"
+	dstListURL := apiBaseURL + "/envvar"
+	dstCreateURL := apiBaseURL + "/envvar"
+
+	srcResp, err := httpmock.NewJsonResponder(200, circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "TEST_ENV_1", Value: "xxxxaaa"},
+			{Name: "TEST_ENV_2", Value: "xxxxbbb"},
+			{Name: "TEST_ENV_3", Value: "xxxxccc"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", srcListURL, srcResp)
+	dstResp, err := httpmock.NewJsonResponder(200, circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "TEST_ENV_1", Value: "xxxxold"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", dstListURL, dstResp)
+
+	created := make(map[string]string)
+	httpmock.RegisterResponder("POST", dstCreateURL,
+		func(r *http.Request) (*http.Response, error) {
+			var pv circleci.ProjectVariable
+			if err := json.NewDecoder(r.Body).Decode(&pv); err != nil {
+				return httpmock.NewStringResponse(500, err.Error()), nil
+			}
+			created[pv.Name] = pv.Value
+			return httpmock.NewJsonResponse(201, pv)
+		})
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().ReadSecret(gomock.Any()).Return("ccc", nil)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+
+	src := &Client{
+		ci:          ci,
+		projectSlug: srcSlug,
+		ui:          ui,
+		token:       testAPIToken,
+	}
+	var msgs bytes.Buffer
+	dst := &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		ui:          ui,
+		reporter:    newReporter(&msgs),
+		token:       testAPIToken,
+	}
+	names := []string{"TEST_ENV_1", "TEST_ENV_3", "NOT_FOUND"}
+	if _, err := dst.CopyVariablesFrom(context.Background(), src, names, "fixtures/dotenv.test", "dotenv"); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, map[string]string{"TEST_ENV_1": "aaa", "TEST_ENV_3": "ccc"}, created)
+	assert.Equal(t, 1, strings.Count(msgs.String(), "TEST_ENV_3"), "The result should be reported once:\n%s", msgs.String())
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["GET "+srcListURL], "Expected number of source list API call is wrong")
+	assert.Equal(t, 1, info["GET "+dstListURL], "Expected number of destination list API call is wrong")
+}
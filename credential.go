@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the credential stores which keep the API tokens
+const (
+	// CredentialStoreFile keeps the tokens in the config file. It is the default.
+	CredentialStoreFile = "file"
+	// CredentialStoreKeyring keeps the tokens in the Secret Service keyring by `secret-tool`
+	CredentialStoreKeyring = "keyring"
+	// CredentialStoreHelper keeps the tokens by an external command in the same protocol as git credential helpers
+	CredentialStoreHelper = "helper"
+)
+
+// ErrCredentialNotFound is returned when the credential store has no token for the profile
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// CredentialStore keeps the API tokens of the profiles outside the config file
+type CredentialStore interface {
+	Get(profile string) (string, error)
+	Store(profile string, token string) error
+}
+
+// credentialStores creates the credential stores by names
+// CredentialStoreFile is not included since the tokens are kept in the config file itself
+var credentialStores = map[string]func(f *ConfigFile) (CredentialStore, error){
+	CredentialStoreKeyring: func(f *ConfigFile) (CredentialStore, error) {
+		return &keyringStore{}, nil
+	},
+	CredentialStoreHelper: func(f *ConfigFile) (CredentialStore, error) {
+		if f.CredentialHelper == "" {
+			return nil, errors.New("credential helper is not set. Please execute `ccienv config set credentialhelper <command>`")
+		}
+		return &helperStore{command: f.CredentialHelper, file: f}, nil
+	},
+}
+
+// credentialStore returns the credential store of the config file
+// nil is returned if the tokens are kept in the config file
+func (f *ConfigFile) credentialStore() (CredentialStore, error) {
+	if f.CredentialStore == "" || f.CredentialStore == CredentialStoreFile {
+		return nil, nil
+	}
+	newStore, prs := credentialStores[f.CredentialStore]
+	if !prs {
+		return nil, fmt.Errorf("unknown credential store: %s", f.CredentialStore)
+	}
+	return newStore(f)
+}
+
+// credential returns the API token of the profile in the credential store
+// An empty token is returned if the store has no token or is not available (e.g. `secret-tool` is not installed).
+func (f *ConfigFile) credential(profile string) string {
+	store, err := f.credentialStore()
+	if err == nil && store == nil {
+		return ""
+	}
+	var token string
+	if err == nil {
+		token, err = store.Get(profile)
+	}
+	if err != nil && !errors.Is(err, ErrCredentialNotFound) {
+		logrus.WithFields(logrus.Fields{"profile": profile, "error": err}).Warn("Failed to read the API token from the credential store.")
+	}
+	return token
+}
+
+// LoadCredentials fills the empty tokens of all the profiles from the credential store
+// It is used to move the tokens to another store. The tokens which cannot be read are left empty.
+func (f *ConfigFile) LoadCredentials() {
+	if f.ApiToken == "" {
+		f.ApiToken = f.credential(DefaultProfileName)
+	}
+	for _, name := range f.ProfileNames() {
+		if p := f.Profiles[name]; p.ApiToken == "" {
+			p.ApiToken = f.credential(name)
+		}
+	}
+}
+
+// storeCredentials moves the tokens of the profiles to the credential store
+// The returned config file has no tokens if the credential store is used
+func (f *ConfigFile) storeCredentials() (*ConfigFile, error) {
+	store, err := f.credentialStore()
+	if err != nil || store == nil {
+		return f, err
+	}
+	put := func(name string, token string) error {
+		if token == "" {
+			return nil
+		}
+		if err := store.Store(name, token); err != nil {
+			return fmt.Errorf("store credential of %s: %w", name, err)
+		}
+		return nil
+	}
+	cp := *f
+	if err := put(DefaultProfileName, cp.ApiToken); err != nil {
+		return nil, err
+	}
+	cp.ApiToken = ""
+	if f.Profiles != nil {
+		cp.Profiles = make(map[string]*Config, len(f.Profiles))
+		for name, p := range f.Profiles {
+			if err := put(name, p.ApiToken); err != nil {
+				return nil, err
+			}
+			pc := *p
+			pc.ApiToken = ""
+			cp.Profiles[name] = &pc
+		}
+	}
+	return &cp, nil
+}
+
+// keyringStore keeps the tokens in the Secret Service keyring (e.g. GNOME Keyring) by `secret-tool` of libsecret
+type keyringStore struct{}
+
+func (s *keyringStore) attributes(profile string) []string {
+	return []string{"service", "ccienv", "profile", profile}
+}
+
+func (s *keyringStore) Get(profile string) (string, error) {
+	cmd := exec.Command("secret-tool", append([]string{"lookup"}, s.attributes(profile)...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// secret-tool exits with 1 without output if the secret does not exist
+		if errors.As(err, &exitErr) && len(out) == 0 {
+			return "", ErrCredentialNotFound
+		}
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func (s *keyringStore) Store(profile string, token string) error {
+	args := append([]string{"store", "--label", "ccienv API token (" + profile + ")"}, s.attributes(profile)...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(token)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("keyring: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// helperStore keeps the tokens by an external command like git credential helpers
+// The command is executed by the shell with the action (`get` or `store`) and receives the attributes from stdin.
+// The profile name is passed as the username, and the host of the profile as the host.
+type helperStore struct {
+	command string
+	// file is the config file to look up the hosts of the profiles
+	file *ConfigFile
+}
+
+func (s *helperStore) run(action string, attrs map[string]string) (map[string]string, error) {
+	var in bytes.Buffer
+	for _, k := range []string{"protocol", "host", "username", "password"} {
+		if v, prs := attrs[k]; prs {
+			fmt.Fprintf(&in, "%s=%s\n", k, v)
+		}
+	}
+	in.WriteString("\n")
+
+	cmd := exec.Command("sh", "-c", s.command+" "+action)
+	cmd.Stdin = &in
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s: %w", action, err)
+	}
+	res := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), "="); ok {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+func (s *helperStore) attributes(profile string) map[string]string {
+	host := defaultHost
+	if s.file != nil {
+		if p, err := s.file.Profile(profile); err == nil {
+			host = p.host()
+		}
+	}
+	attrs := map[string]string{
+		"protocol": "https",
+		"host":     "circleci.com",
+		"username": profile,
+	}
+	// The tokens of CircleCI Server are kept separately from the ones of circleci.com
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		attrs["protocol"] = u.Scheme
+		attrs["host"] = u.Host
+	}
+	return attrs
+}
+
+func (s *helperStore) Get(profile string) (string, error) {
+	res, err := s.run("get", s.attributes(profile))
+	if err != nil {
+		return "", err
+	}
+	if res["password"] == "" {
+		return "", ErrCredentialNotFound
+	}
+	return res["password"], nil
+}
+
+func (s *helperStore) Store(profile string, token string) error {
+	attrs := s.attributes(profile)
+	attrs["password"] = token
+	_, err := s.run("store", attrs)
+	return err
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCredentialStore is a credential store for tests which keeps the tokens in a JSON file
+type fakeCredentialStore struct {
+	path string
+}
+
+func (s *fakeCredentialStore) read() (map[string]string, error) {
+	tokens := make(map[string]string)
+	bt, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return tokens, json.Unmarshal(bt, &tokens)
+}
+
+func (s *fakeCredentialStore) Get(profile string) (string, error) {
+	tokens, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	t, prs := tokens[profile]
+	if !prs {
+		return "", ErrCredentialNotFound
+	}
+	return t, nil
+}
+
+func (s *fakeCredentialStore) Store(profile string, token string) error {
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	tokens[profile] = token
+	bt, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, bt, 0600)
+}
+
+// useFakeCredentialStore registers the fake as the credential store named `fake`
+// CredentialHelper of the config file is used as the path of the fake
+func useFakeCredentialStore(t *testing.T) {
+	credentialStores["fake"] = func(f *ConfigFile) (CredentialStore, error) {
+		return &fakeCredentialStore{path: f.CredentialHelper}, nil
+	}
+	t.Cleanup(func() { delete(credentialStores, "fake") })
+}
+
+func TestWriteConfigFile_CredentialStore(t *testing.T) {
+	cleaner, err := prepareConfigPath()
+	if err != nil {
+		t.Errorf("Failed to prepare: %v", err)
+	}
+	defer cleaner()
+	useFakeCredentialStore(t)
+	storePath := filepath.Join(t.TempDir(), "tokens.json")
+
+	f := &ConfigFile{
+		Config:           Config{ApiToken: "abc", OrganizationName: "cde"},
+		CredentialStore:  "fake",
+		CredentialHelper: storePath,
+		Profiles: map[string]*Config{
+			"work": {ApiToken: "tkn1", OrganizationName: "org1"},
+		},
+	}
+	if err := WriteConfigFile(f); err != nil {
+		t.Fatal(err)
+	}
+	// The tokens are not written to the config file
+	path, _ := getConfigPath()
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.NotContains(t, string(dat), "abc")
+	assert.NotContains(t, string(dat), "tkn1")
+	assert.Equal(t, "abc", f.ApiToken, "the argument is not changed")
+
+	got, err := ReadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", got.ApiToken, "the tokens are not read with the file")
+	p, err := got.ProfileWithEnv("work")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{ApiToken: "tkn1", OrganizationName: "org1"}, p)
+
+	got.LoadCredentials()
+	assert.Equal(t, f, got)
+}
+
+func TestReadConfig_CredentialStoreUnavailable(t *testing.T) {
+	cleaner, err := prepareConfigPath()
+	if err != nil {
+		t.Errorf("Failed to prepare: %v", err)
+	}
+	defer cleaner()
+	if err := prepareConfig("credentialstore: keyring\norganizationname: cde\n"); err != nil {
+		t.Errorf("Failed to prepare a config file: %v", err)
+	}
+	// secret-tool is not found
+	t.Setenv("PATH", t.TempDir())
+
+	f, err := ReadConfigFileOrEmpty()
+	assert.NoError(t, err)
+	assert.Equal(t, "cde", f.OrganizationName)
+
+	_, err = ReadConfig()
+	assert.ErrorIs(t, err, ErrNoConfig)
+
+	t.Setenv("CCIENV_API_TOKEN", "abc")
+	got, err := ReadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{ApiToken: "abc", OrganizationName: "cde"}, got)
+}
+
+func TestWriteConfigFile_Permissions(t *testing.T) {
+	cleaner, err := prepareConfigPath()
+	if err != nil {
+		t.Errorf("Failed to prepare: %v", err)
+	}
+	defer cleaner()
+	if err := prepareConfig("apitoken: abc\n"); err != nil {
+		t.Errorf("Failed to prepare a config file: %v", err)
+	}
+	if err := WriteConfig(&Config{ApiToken: "efg"}); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := getConfigPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestHelperStore(t *testing.T) {
+	// A credential helper which keeps only one password in a file
+	dir := t.TempDir()
+	script := filepath.Join(dir, "helper.sh")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+case "$1" in
+get) if [ -f "$0.pass" ]; then cat "$0.pass"; fi ;;
+store) grep '^password=' > "$0.pass" ;;
+esac
+`), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &helperStore{command: script}
+	_, err = s.Get("work")
+	assert.ErrorIs(t, err, ErrCredentialNotFound)
+
+	if err := s.Store("work", "tkn1"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get("work")
+	assert.NoError(t, err)
+	assert.Equal(t, "tkn1", got)
+}
+
+func TestHelperStore_attributes(t *testing.T) {
+	f := &ConfigFile{Profiles: map[string]*Config{
+		"onprem": {Host: "https://circleci.example.com:8443/"},
+	}}
+	s := &helperStore{command: "true", file: f}
+	assert.Equal(t, map[string]string{"protocol": "https", "host": "circleci.com", "username": "default"}, s.attributes(DefaultProfileName))
+	assert.Equal(t, map[string]string{"protocol": "https", "host": "circleci.example.com:8443", "username": "onprem"}, s.attributes("onprem"))
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/grezar/go-circleci"
+)
+
+// ErrVariablesDiffer is returned when the local variables differ from the project's ones.
+var ErrVariablesDiffer = errors.New("variables differ")
+
+// maskValue masks a value in the same way as CircleCI does. (e.g. `xxxx1234`)
+func maskValue(v string) string {
+	r := []rune(v)
+	if len(r) > 4 {
+		r = r[len(r)-4:]
+	}
+	return "xxxx" + string(r)
+}
+
+type variableDiff struct {
+	onlyLocal  []string
+	onlyRemote []string
+	changed    []string
+	unchanged  []string
+}
+
+func (d *variableDiff) hasDifference() bool {
+	return len(d.onlyLocal) > 0 || len(d.onlyRemote) > 0 || len(d.changed) > 0
+}
+
+func variableNames(pvs []*circleci.ProjectVariable) []string {
+	names := make([]string, len(pvs))
+	for i, v := range pvs {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// diffVariables compares local variables with remote (masked) variables.
+// Variables on both sides are regarded as changed if the last four characters differ.
+func diffVariables(local []*circleci.ProjectVariable, remote []*circleci.ProjectVariable) *variableDiff {
+	d := &variableDiff{
+		changed:   make([]string, 0),
+		unchanged: make([]string, 0),
+	}
+	both, onlyLocal := getFoundAndNotFoundVariables(variableNames(local), remote)
+	_, onlyRemote := getFoundAndNotFoundVariables(variableNames(remote), local)
+	d.onlyLocal = onlyLocal
+	d.onlyRemote = onlyRemote
+
+	lmp := makeProjectVariableMap(local)
+	for _, rv := range both {
+		if maskValue(lmp[rv.Name].Value) == rv.Value {
+			d.unchanged = append(d.unchanged, rv.Name)
+		} else {
+			d.changed = append(d.changed, rv.Name)
+		}
+	}
+	sort.Strings(d.onlyLocal)
+	sort.Strings(d.onlyRemote)
+	sort.Strings(d.changed)
+	sort.Strings(d.unchanged)
+	return d
+}
+
+func dumpNames(w io.Writer, msg string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintln(w, msg)
+	for _, n := range names {
+		fmt.Fprintln(w, "  "+n)
+	}
+	fmt.Fprintln(w)
+}
+
+// DiffVariablesFromFile compares a file (or stdin) with the project variables
+// The results are sorted by the status and names. Use HasDifference to check if there are any differences.
+// If the path is empty, stdin will be used as input
+func (c *Client) DiffVariablesFromFile(ctx context.Context, path string, filetype string) ([]*DiffRecord, error) {
+	pvs, err := readVariables(c.ui, c.opts.AgeKeyFile, path, filetype)
+	if err != nil {
+		return nil, fmt.Errorf("diff vars: %w", err)
+	}
+	vs, err := c.listAllVariables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("diff vars: %w", err)
+	}
+	return diffVariables(pvs, vs).records(), nil
+}
+
+// HasDifference reports whether any of the variables differ
+func HasDifference(rs []*DiffRecord) bool {
+	for _, r := range rs {
+		if r.Status != DiffUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffRecord is a variable compared by diff
+type DiffRecord struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+}
+
+const (
+	DiffOnlyLocal  = "only_local"
+	DiffOnlyRemote = "only_remote"
+	DiffChanged    = "changed"
+	DiffUnchanged  = "unchanged"
+)
+
+func (d *variableDiff) records() []*DiffRecord {
+	rs := make([]*DiffRecord, 0)
+	for _, g := range []struct {
+		status string
+		names  []string
+	}{
+		{DiffOnlyLocal, d.onlyLocal},
+		{DiffOnlyRemote, d.onlyRemote},
+		{DiffChanged, d.changed},
+		{DiffUnchanged, d.unchanged},
+	} {
+		for _, n := range g.names {
+			rs = append(rs, &DiffRecord{Name: n, Status: g.status})
+		}
+	}
+	return rs
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/grezar/go-circleci"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_maskValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{name: "long value", v: "abcdefgh", want: "xxxxefgh"},
+		{name: "four characters", v: "abcd", want: "xxxxabcd"},
+		{name: "short value", v: "ab", want: "xxxxab"},
+		{name: "multibyte characters", v: "あいうえお", want: "xxxxいうえお"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, maskValue(tt.v))
+		})
+	}
+}
+
+func Test_diffVariables(t *testing.T) {
+	local := []*circleci.ProjectVariable{
+		{Name: "LOCAL_ONLY", Value: "aaaa"},
+		{Name: "SAME", Value: "secret1234"},
+		{Name: "CHANGED", Value: "secret5678"},
+	}
+	remote := []*circleci.ProjectVariable{
+		{Name: "SAME", Value: "xxxx1234"},
+		{Name: "CHANGED", Value: "xxxx1234"},
+		{Name: "REMOTE_ONLY", Value: "xxxxbbbb"},
+	}
+	got := diffVariables(local, remote)
+	assert.Equal(t, []string{"LOCAL_ONLY"}, got.onlyLocal)
+	assert.Equal(t, []string{"REMOTE_ONLY"}, got.onlyRemote)
+	assert.Equal(t, []string{"CHANGED"}, got.changed)
+	assert.Equal(t, []string{"SAME"}, got.unchanged)
+	assert.True(t, got.hasDifference())
+
+	same := diffVariables(local[1:2], remote[0:1])
+	assert.False(t, same.hasDifference())
+}
@@ -0,0 +1,393 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/adrg/xdg"
+	"github.com/grezar/go-circleci"
+	"gopkg.in/yaml.v3"
+)
+
+// The encrypted formats are registered at init
+// since parseAgeToVariables parses the decrypted content with the registry.
+func init() {
+	fileFormats[FileTypeAge] = &fileFormat{
+		extensions: []string{".age"},
+		detect:     looksLikeAge,
+		parse:      parseAgeToVariables,
+	}
+	fileFormats[FileTypeSops] = &fileFormat{
+		detect: sopsPattern.MatchString,
+		parse:  parseSopsToVariables,
+	}
+}
+
+func looksLikeAge(body string) bool {
+	s := strings.TrimSpace(body)
+	return strings.HasPrefix(s, "age-encryption.org/") || strings.HasPrefix(s, armor.Header)
+}
+
+// sopsPattern matches the values encrypted by sops
+var sopsPattern = regexp.MustCompile(`ENC\[AES256_GCM,`)
+
+// ageKeyFilePath returns the path of the age identities to decrypt inputs
+// keyFile is used if it is not empty, then SOPS_AGE_KEY_FILE and the default path of sops
+func ageKeyFilePath(keyFile string) string {
+	if keyFile != "" {
+		return keyFile
+	}
+	if p := os.Getenv("SOPS_AGE_KEY_FILE"); p != "" {
+		return p
+	}
+	return filepath.Join(xdg.ConfigHome, "sops", "age", "keys.txt")
+}
+
+func readAgeIdentities(keyFile string) ([]age.Identity, error) {
+	path := ageKeyFilePath(keyFile)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read age identities: %w", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("read age identities from %s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// decryptAge decrypts an age file in the binary or the armored format
+func decryptAge(data []byte, ids []age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(src, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// parseAgeToVariables decrypts an age-encrypted file
+// The format of the decrypted content is detected in the same way as plaintext inputs.
+func parseAgeToVariables(body string, keyFile string) ([]*circleci.ProjectVariable, error) {
+	ids, err := readAgeIdentities(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("parse age to variables: %w", err)
+	}
+	bt, err := decryptAge([]byte(body), ids)
+	if err != nil {
+		return nil, fmt.Errorf("parse age to variables: %w", err)
+	}
+	return parseVariables(string(bt), detectFileType("", string(bt)), keyFile)
+}
+
+// sopsAgeKey is a data key of sops encrypted for an age recipient
+type sopsAgeKey struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+type sopsMetadata struct {
+	Age          []*sopsAgeKey `yaml:"age"`
+	LastModified string        `yaml:"lastmodified"`
+	MAC          string        `yaml:"mac"`
+	// The rules of the keys whose values are encrypted. At most one of them is set.
+	UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	EncryptedSuffix   string `yaml:"encrypted_suffix"`
+	UnencryptedRegex  string `yaml:"unencrypted_regex"`
+	EncryptedRegex    string `yaml:"encrypted_regex"`
+	// MACOnlyEncrypted excludes the unencrypted values from the MAC
+	MACOnlyEncrypted bool `yaml:"mac_only_encrypted"`
+}
+
+// encrypted returns whether the value of the key must be encrypted by the rules of the metadata
+func (md *sopsMetadata) encrypted() (func(key string) bool, error) {
+	switch {
+	case md.UnencryptedSuffix != "":
+		return func(key string) bool { return !strings.HasSuffix(key, md.UnencryptedSuffix) }, nil
+	case md.EncryptedSuffix != "":
+		return func(key string) bool { return strings.HasSuffix(key, md.EncryptedSuffix) }, nil
+	case md.UnencryptedRegex != "", md.EncryptedRegex != "":
+		re, err := regexp.Compile(md.UnencryptedRegex + md.EncryptedRegex)
+		if err != nil {
+			return nil, fmt.Errorf("sops metadata: %w", err)
+		}
+		want := md.EncryptedRegex != ""
+		return func(key string) bool { return re.MatchString(key) == want }, nil
+	}
+	return func(string) bool { return true }, nil
+}
+
+// sopsEntry is a variable of a sops file
+type sopsEntry struct {
+	name  string
+	value string
+	// macValue is the unencrypted value as sops writes it into the MAC (e.g. `True` for booleans of YAML)
+	macValue string
+}
+
+// sopsValuePattern matches a value encrypted by sops
+var sopsValuePattern = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// decryptSops decrypts a value of sops with the data key and the additional data
+func decryptSops(value string, key []byte, aad string) (string, error) {
+	m := sopsValuePattern.FindStringSubmatch(value)
+	if m == nil {
+		return "", errors.New("the value is not encrypted")
+	}
+	var parts [3][]byte
+	for i, s := range m[1:4] {
+		bt, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = bt
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// decryptSopsValue decrypts a value of sops with the data key
+// The path of the value is authenticated as the additional data in the same way as sops.
+func decryptSopsValue(value string, key []byte, path string) (string, error) {
+	plain, err := decryptSops(value, key, path+":")
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return plain, nil
+}
+
+// verifySopsMAC compares the MAC of the metadata with the hash of the values
+// The MAC is encrypted with the last modified time as the additional data.
+func verifySopsMAC(md *sopsMetadata, key []byte, sum []byte) error {
+	if md.MAC == "" {
+		return errors.New("no MAC in the sops metadata")
+	}
+	lastModified, err := time.Parse(time.RFC3339, md.LastModified)
+	if err != nil {
+		return fmt.Errorf("sops metadata: lastmodified: %w", err)
+	}
+	mac, err := decryptSops(md.MAC, key, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("decrypt the MAC: %w", err)
+	}
+	if mac != fmt.Sprintf("%X", sum) {
+		return errors.New("the MAC does not match. The file may be modified without sops")
+	}
+	return nil
+}
+
+// sopsDataKey decrypts the data key of sops with one of the age identities
+func sopsDataKey(md *sopsMetadata, ids []age.Identity) ([]byte, error) {
+	if md == nil || len(md.Age) == 0 {
+		return nil, errors.New("no age recipients in the sops metadata")
+	}
+	var errs []string
+	for _, k := range md.Age {
+		key, err := decryptAge([]byte(k.Enc), ids)
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", k.Recipient, err))
+	}
+	return nil, fmt.Errorf("decrypt the data key: %s", strings.Join(errs, ", "))
+}
+
+// sopsDotenvAgePattern matches the keys of the age recipients flattened in dotenv files
+var sopsDotenvAgePattern = regexp.MustCompile(`^sops_age__list_(\d+)__map_(recipient|enc)$`)
+
+// parseSopsDotenv splits a dotenv file of sops into the variables and the metadata
+// The lines are parsed in the same way as sops, where `\n` in values is a newline.
+// The metadata is flattened into the keys like `sops_age__list_0__map_enc`.
+func parseSopsDotenv(body string) ([]*sopsEntry, *sopsMetadata, error) {
+	entries := make([]*sopsEntry, 0)
+	md := &sopsMetadata{}
+	keys := make(map[int]*sopsAgeKey)
+	for i, line := range strings.Split(body, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pos := strings.Index(line, "=")
+		if pos < 0 {
+			return nil, nil, &ParseError{Format: FileTypeSops, Line: i + 1, Column: 1, Msg: "`=` is expected"}
+		}
+		k, v := line[:pos], strings.ReplaceAll(line[pos+1:], `\n`, "\n")
+		if !strings.HasPrefix(k, "sops_") {
+			entries = append(entries, &sopsEntry{name: k, value: v, macValue: v})
+			continue
+		}
+		switch k {
+		case "sops_lastmodified":
+			md.LastModified = v
+		case "sops_mac":
+			md.MAC = v
+		case "sops_unencrypted_suffix":
+			md.UnencryptedSuffix = v
+		case "sops_encrypted_suffix":
+			md.EncryptedSuffix = v
+		case "sops_unencrypted_regex":
+			md.UnencryptedRegex = v
+		case "sops_encrypted_regex":
+			md.EncryptedRegex = v
+		case "sops_mac_only_encrypted":
+			md.MACOnlyEncrypted = v == "true"
+		}
+		m := sopsDotenvAgePattern.FindStringSubmatch(k)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if keys[n] == nil {
+			keys[n] = &sopsAgeKey{}
+		}
+		if m[2] == "enc" {
+			keys[n].Enc = v
+		} else {
+			keys[n].Recipient = v
+		}
+	}
+	idx := make([]int, 0, len(keys))
+	for i := range keys {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		md.Age = append(md.Age, keys[i])
+	}
+	return entries, md, nil
+}
+
+// sopsMACValue returns the unencrypted scalar as sops writes it into the MAC
+func sopsMACValue(n *yaml.Node) string {
+	switch n.Tag {
+	case "!!bool":
+		if b, err := strconv.ParseBool(n.Value); err == nil && b {
+			return "True"
+		} else if err == nil {
+			return "False"
+		}
+	case "!!float":
+		if f, err := strconv.ParseFloat(n.Value, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+	return n.Value
+}
+
+// parseSopsYaml splits a YAML or JSON file of sops into the variables and the metadata
+// Only flat maps of scalar values are supported as variables.
+func parseSopsYaml(body string) ([]*sopsEntry, *sopsMetadata, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, nil, yamlParseError(err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, errors.New("a map of names and values is expected")
+	}
+	root := doc.Content[0]
+	entries := make([]*sopsEntry, 0, len(root.Content)/2)
+	var md *sopsMetadata
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k, n := root.Content[i].Value, root.Content[i+1]
+		if k == "sops" {
+			md = &sopsMetadata{}
+			if err := n.Decode(md); err != nil {
+				return nil, nil, fmt.Errorf("sops metadata: %w", err)
+			}
+			continue
+		}
+		if n.Kind != yaml.ScalarNode {
+			return nil, nil, fmt.Errorf("%s: nested values are not supported", k)
+		}
+		entries = append(entries, &sopsEntry{name: k, value: n.Value, macValue: sopsMACValue(n)})
+	}
+	if md == nil {
+		return nil, nil, errors.New("no sops metadata is found")
+	}
+	return entries, md, nil
+}
+
+// sopsDotenvPattern matches the metadata of sops in dotenv files
+var sopsDotenvPattern = regexp.MustCompile(`(?m)^sops_[a-z_]+=`)
+
+// parseSopsToVariables decrypts a file encrypted by sops with age
+// YAML, JSON and dotenv files are supported. The MAC of the file is verified,
+// and the values which must be encrypted by the rules of the metadata (e.g. `unencrypted_suffix`) are rejected if they are not.
+func parseSopsToVariables(body string, keyFile string) ([]*circleci.ProjectVariable, error) {
+	parse := parseSopsYaml
+	if sopsDotenvPattern.MatchString(body) {
+		parse = parseSopsDotenv
+	}
+	entries, md, err := parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse sops to variables: %w", err)
+	}
+	encrypted, err := md.encrypted()
+	if err != nil {
+		return nil, fmt.Errorf("parse sops to variables: %w", err)
+	}
+	ids, err := readAgeIdentities(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("parse sops to variables: %w", err)
+	}
+	key, err := sopsDataKey(md, ids)
+	if err != nil {
+		return nil, fmt.Errorf("parse sops to variables: %w", err)
+	}
+
+	// The MAC is the hash of the values in the order of the file
+	hash := sha512.New()
+	pvs := make([]*circleci.ProjectVariable, len(entries))
+	for i, e := range entries {
+		v, macValue := e.value, e.macValue
+		enc := encrypted(e.name)
+		if enc {
+			if !sopsValuePattern.MatchString(v) {
+				return nil, fmt.Errorf("parse sops to variables: %s is not encrypted", e.name)
+			}
+			if v, err = decryptSopsValue(v, key, e.name); err != nil {
+				return nil, fmt.Errorf("parse sops to variables: %w", err)
+			}
+			macValue = v
+		}
+		if enc || !md.MACOnlyEncrypted {
+			hash.Write([]byte(macValue))
+		}
+		pvs[i] = &circleci.ProjectVariable{Name: e.name, Value: v}
+	}
+	if err := verifySopsMAC(md, key, hash.Sum(nil)); err != nil {
+		return nil, fmt.Errorf("parse sops to variables: %w", err)
+	}
+	sort.Slice(pvs, func(i, j int) bool { return pvs[i].Name < pvs[j].Name })
+	return pvs, nil
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/grezar/go-circleci"
+	"github.com/stretchr/testify/assert"
+)
+
+// prepareAgeKey writes a new age identity into a key file
+func prepareAgeKey(t *testing.T) (*age.X25519Identity, string) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte("# test key\n"+id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return id, path
+}
+
+func encryptAgeArmored(t *testing.T, data []byte, r age.Recipient) string {
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	aw.Close()
+	return buf.String()
+}
+
+// encryptSopsValue encrypts a value in the same way as sops
+func encryptSopsValue(t *testing.T, value string, key []byte, path string) string {
+	return encryptSops(t, value, key, path+":")
+}
+
+// sopsMAC returns the encrypted MAC of the values
+func sopsMAC(t *testing.T, key []byte, lastModified string, values ...string) string {
+	hash := sha512.New()
+	for _, v := range values {
+		hash.Write([]byte(v))
+	}
+	return encryptSops(t, fmt.Sprintf("%X", hash.Sum(nil)), key, lastModified)
+}
+
+func encryptSops(t *testing.T, value string, key []byte, aad string) string {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, 32)
+	rand.Read(iv)
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := gcm.Seal(nil, iv, []byte(value), []byte(aad))
+	data, tag := out[:len(out)-gcm.Overhead()], out[len(out)-gcm.Overhead():]
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]", b64(data), b64(iv), b64(tag))
+}
+
+func Test_parseAgeToVariables(t *testing.T) {
+	id, keyFile := prepareAgeKey(t)
+	tests := []struct {
+		name  string
+		plain string
+	}{
+		{"dotenv", "TEST_ENV_1=aaa\n"},
+		{"json", `[{"name":"TEST_ENV_1","value":"aaa"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := encryptAgeArmored(t, []byte(tt.plain), id.Recipient())
+			got, err := parseAgeToVariables(body, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, []*circleci.ProjectVariable{{Name: "TEST_ENV_1", Value: "aaa"}}, got)
+		})
+	}
+
+	other, _ := prepareAgeKey(t)
+	body := encryptAgeArmored(t, []byte("TEST_ENV_1=aaa\n"), other.Recipient())
+	_, err := parseAgeToVariables(body, keyFile)
+	assert.Error(t, err, "the file is encrypted for another key")
+}
+
+func Test_parseSopsToVariables(t *testing.T) {
+	id, keyFile := prepareAgeKey(t)
+	key := make([]byte, 32)
+	rand.Read(key)
+	enc := encryptAgeArmored(t, key, id.Recipient())
+	recipient := id.Recipient().String()
+	lastModified := "2023-05-01T00:00:00Z"
+	mac := sopsMAC(t, key, lastModified, "aaa", "bbb", "ccc")
+
+	yamlBody := fmt.Sprintf(`TEST_ENV_1: %s
+TEST_ENV_2: %s
+PLAIN_unencrypted: ccc
+sops:
+    age:
+        - recipient: %s
+          enc: |
+%s
+    lastmodified: "%s"
+    mac: %s
+    unencrypted_suffix: _unencrypted
+    version: 3.7.3
+`, encryptSopsValue(t, "aaa", key, "TEST_ENV_1"), encryptSopsValue(t, "bbb", key, "TEST_ENV_2"),
+		recipient, "            "+strings.ReplaceAll(strings.TrimSpace(enc), "\n", "\n            "), lastModified, mac)
+	jsonBody := fmt.Sprintf(`{
+	"TEST_ENV_1": %q,
+	"TEST_ENV_2": %q,
+	"PLAIN_unencrypted": "ccc",
+	"sops": {"age": [{"recipient": %q, "enc": %q}], "lastmodified": %q, "mac": %q, "unencrypted_suffix": "_unencrypted", "version": "3.7.3"}
+}`, encryptSopsValue(t, "aaa", key, "TEST_ENV_1"), encryptSopsValue(t, "bbb", key, "TEST_ENV_2"), recipient, enc, lastModified, mac)
+	dotenvBody := fmt.Sprintf(`# comment
+TEST_ENV_1=%s
+TEST_ENV_2=%s
+PLAIN_unencrypted=ccc
+sops_age__list_0__map_enc=%s
+sops_age__list_0__map_recipient=%s
+sops_lastmodified=%s
+sops_mac=%s
+sops_unencrypted_suffix=_unencrypted
+sops_version=3.7.3
+`, encryptSopsValue(t, "aaa", key, "TEST_ENV_1"), encryptSopsValue(t, "bbb", key, "TEST_ENV_2"),
+		strings.ReplaceAll(enc, "\n", `\n`), recipient, lastModified, mac)
+
+	want := []*circleci.ProjectVariable{
+		{Name: "PLAIN_unencrypted", Value: "ccc"},
+		{Name: "TEST_ENV_1", Value: "aaa"},
+		{Name: "TEST_ENV_2", Value: "bbb"},
+	}
+	for name, body := range map[string]string{"yaml": yamlBody, "json": jsonBody, "dotenv": dotenvBody} {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseSopsToVariables(body, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+
+	t.Run("value moved to another key", func(t *testing.T) {
+		body := strings.Replace(yamlBody, "TEST_ENV_2:", "TEST_ENV_3:", 1)
+		_, err := parseSopsToVariables(body, keyFile)
+		assert.ErrorContains(t, err, "TEST_ENV_3")
+	})
+	t.Run("unencrypted value added", func(t *testing.T) {
+		body := strings.Replace(yamlBody, "PLAIN_unencrypted:", "INJECTED: ddd\nPLAIN_unencrypted:", 1)
+		_, err := parseSopsToVariables(body, keyFile)
+		assert.ErrorContains(t, err, "INJECTED is not encrypted")
+	})
+	t.Run("unencrypted value changed", func(t *testing.T) {
+		body := strings.Replace(dotenvBody, "PLAIN_unencrypted=ccc", "PLAIN_unencrypted=ddd", 1)
+		_, err := parseSopsToVariables(body, keyFile)
+		assert.ErrorContains(t, err, "the MAC does not match")
+	})
+	t.Run("last modified time changed", func(t *testing.T) {
+		body := strings.Replace(yamlBody, "lastmodified: \"2023-05-01T00:00:00Z\"", "lastmodified: \"2023-05-02T00:00:00Z\"", 1)
+		_, err := parseSopsToVariables(body, keyFile)
+		assert.ErrorContains(t, err, "decrypt the MAC")
+	})
+	t.Run("nested values", func(t *testing.T) {
+		_, err := parseSopsToVariables("NESTED:\n  A: b\nsops:\n  age: []\n", keyFile)
+		assert.ErrorContains(t, err, "nested values are not supported")
+	})
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCancelled is returned when the user answers no to a confirmation
+var ErrCancelled = errors.New("cancelled by user")
+
+// FailedItem is an item which failed in a bulk operation
+type FailedItem struct {
+	Name      string
+	Operation string
+	Err       error
+}
+
+// OperationError is returned when some of the items in a bulk operation fail
+// The other items are applied even if some of them fail
+type OperationError struct {
+	// Total is the number of items attempted. Skipped items are not counted.
+	Total  int
+	Failed []*FailedItem
+}
+
+func (e *OperationError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		msgs[i] = fmt.Sprintf("%s (%s: %v)", f.Name, f.Operation, f.Err)
+	}
+	return fmt.Sprintf("%d of %d operations failed: %s", len(e.Failed), e.Total, strings.Join(msgs, ", "))
+}
+
+// Partial reports whether some of the items succeeded
+func (e *OperationError) Partial() bool {
+	return len(e.Failed) < e.Total
+}
+
+// Is reports whether any of the failed items matches target
+func (e *OperationError) Is(target error) bool {
+	for _, f := range e.Failed {
+		if errors.Is(f.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResults returns an OperationError if any of rs failed
+func checkResults(rs []*ResultRecord) error {
+	e := &OperationError{}
+	for _, r := range rs {
+		if r.Result == ResultSkipped {
+			continue
+		}
+		e.Total++
+		if r.Result == ResultFailed {
+			err := r.err
+			if err == nil {
+				err = errors.New(r.Error)
+			}
+			e.Failed = append(e.Failed, &FailedItem{Name: r.Name, Operation: r.Operation, Err: err})
+		}
+	}
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e
+}
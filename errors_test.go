@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+func Test_checkResults(t *testing.T) {
+	assert.NoError(t, checkResults([]*ResultRecord{
+		newResultRecord("A", "create", nil),
+		{Name: "B", Operation: "create", Result: ResultSkipped},
+	}))
+
+	err := checkResults([]*ResultRecord{
+		newResultRecord("A", "create", nil),
+		newResultRecord("B", "delete", circleci.ErrUnauthorized),
+		{Name: "C", Operation: "delete", Result: ResultSkipped, Error: "not found"},
+	})
+	var opErr *OperationError
+	if assert.True(t, errors.As(err, &opErr)) {
+		assert.Equal(t, 2, opErr.Total)
+		assert.True(t, opErr.Partial())
+		assert.Equal(t, "1 of 2 operations failed: B (delete: unauthorized)", opErr.Error())
+	}
+	assert.ErrorIs(t, err, circleci.ErrUnauthorized)
+
+	err = checkResults([]*ResultRecord{newResultRecord("A", "create", errors.New("boom"))})
+	if assert.True(t, errors.As(err, &opErr)) {
+		assert.False(t, opErr.Partial())
+	}
+}
+
+func setupDeleteTest(t *testing.T, ui UI) *Client {
+	pvl := circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "FOO", Value: "xxxx_foo"},
+			{Name: "BAR", Value: "xxxx_bar"},
+		},
+	}
+	listResp, err := httpmock.NewJsonResponder(200, pvl)
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", apiBaseURL+"/envvar", listResp)
+	httpmock.RegisterResponder("DELETE", apiBaseURL+"/envvar/FOO", httpmock.NewStringResponder(200, `{"message":"OK"}`))
+	httpmock.RegisterResponder("DELETE", apiBaseURL+"/envvar/BAR", httpmock.NewStringResponder(500, `{"message":"internal error"}`))
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+	return &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		ui:          ui,
+		token:       testAPIToken,
+	}
+}
+
+func TestClient_DeleteVariables_partialFailure(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+	c := setupDeleteTest(t, ui)
+
+	rs, err := c.DeleteVariables(context.Background(), []string{"FOO", "BAR", "NOT_FOUND"})
+	var opErr *OperationError
+	if assert.True(t, errors.As(err, &opErr)) {
+		assert.True(t, opErr.Partial())
+		assert.Equal(t, 1, len(opErr.Failed))
+		assert.Equal(t, "BAR", opErr.Failed[0].Name)
+	}
+	assert.Equal(t, []string{ResultSucceeded, ResultFailed, ResultSkipped}, []string{rs[0].Result, rs[1].Result, rs[2].Result})
+}
+
+func TestClient_DeleteVariables_cancelled(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(false, nil)
+	c := setupDeleteTest(t, ui)
+
+	rs, err := c.DeleteVariables(context.Background(), []string{"FOO"})
+	assert.ErrorIs(t, err, ErrCancelled)
+	assert.Nil(t, rs)
+	assert.Equal(t, 0, httpmock.GetCallCountInfo()["DELETE "+apiBaseURL+"/envvar/FOO"])
+}
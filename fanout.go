@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/grezar/go-circleci"
+)
+
+type followedProject struct {
+	Username string `json:"username"`
+	Reponame string `json:"reponame"`
+	VcsType  string `json:"vcs_type"`
+}
+
+// ListFollowedRepos lists names of the repositories in the org which the user follows on CircleCI
+// If pattern is not empty, only the repositories matching the glob pattern are listed
+func ListFollowedRepos(ctx context.Context, cfg *Config, org string, pattern string, opts Options) ([]string, error) {
+	hc, err := newHTTPClient(cfg, opts.MaxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("list followed repos: %w", err)
+	}
+	body, err := requestURL(ctx, hc, cfg.ApiToken, cfg.apiV1URL()+"/projects")
+	if err != nil {
+		return nil, fmt.Errorf("list followed repos: %w", err)
+	}
+	var prjs []*followedProject
+	if err := json.Unmarshal(body, &prjs); err != nil {
+		return nil, fmt.Errorf("list followed repos: %w", err)
+	}
+
+	repos := make([]string, 0)
+	for _, p := range prjs {
+		if !strings.EqualFold(p.Username, org) {
+			continue
+		}
+		if pattern != "" {
+			ok, err := path.Match(pattern, p.Reponame)
+			if err != nil {
+				return nil, fmt.Errorf("list followed repos: %w", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		repos = append(repos, p.Reponame)
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// ProjectOperation is an operation applied to each project by ApplyToProjects
+// It returns a short description of the result
+type ProjectOperation func(ctx context.Context, c *Client) (string, error)
+
+type ProjectResult struct {
+	ProjectSlug string
+	Message     string
+	Err         error
+}
+
+// PutVariablesOperation creates or updates pvs
+func PutVariablesOperation(pvs []*circleci.ProjectVariable) ProjectOperation {
+	return func(ctx context.Context, c *Client) (string, error) {
+		msgs := make([]string, len(pvs))
+		for i, pv := range pvs {
+			v, err := c.ci.Projects.GetVariable(ctx, c.projectSlug, pv.Name)
+			if err != nil && !errors.Is(err, circleci.ErrNotFound) {
+				return strings.Join(msgs[:i], ", "), err
+			}
+			if v != nil && c.opts.NoOverwrite {
+				msgs[i] = "skipped " + pv.Name
+				continue
+			}
+			if c.opts.DryRun {
+				if v != nil {
+					msgs[i] = "would update " + pv.Name
+				} else {
+					msgs[i] = "would create " + pv.Name
+				}
+				continue
+			}
+			_, err = c.ci.Projects.CreateVariable(ctx, c.projectSlug, circleci.ProjectCreateVariableOptions{
+				Name:  &pv.Name,
+				Value: &pv.Value,
+			})
+			c.audit.recordResult(ctx, c.projectSlug, "create", pv.Name, pv.Value, newResultRecord(pv.Name, "create", err))
+			if err != nil {
+				return strings.Join(msgs[:i], ", "), fmt.Errorf("%s: %w", pv.Name, err)
+			}
+			if v != nil {
+				msgs[i] = "updated " + pv.Name
+			} else {
+				msgs[i] = "created " + pv.Name
+			}
+		}
+		return strings.Join(msgs, ", "), nil
+	}
+}
+
+// DeleteVariablesOperation deletes variables. Variables not found are skipped.
+func DeleteVariablesOperation(names []string) ProjectOperation {
+	return func(ctx context.Context, c *Client) (string, error) {
+		msgs := make([]string, len(names))
+		for i, n := range names {
+			var err error
+			if c.opts.DryRun {
+				_, err = c.ci.Projects.GetVariable(ctx, c.projectSlug, n)
+			} else {
+				err = c.ci.Projects.DeleteVariable(ctx, c.projectSlug, n)
+				if !errors.Is(err, circleci.ErrNotFound) {
+					c.audit.recordResult(ctx, c.projectSlug, "delete", n, "", newResultRecord(n, "delete", err))
+				}
+			}
+			switch {
+			case errors.Is(err, circleci.ErrNotFound):
+				msgs[i] = "not found " + n
+			case err != nil:
+				return strings.Join(msgs[:i], ", "), fmt.Errorf("%s: %w", n, err)
+			case c.opts.DryRun:
+				msgs[i] = "would delete " + n
+			default:
+				msgs[i] = "deleted " + n
+			}
+		}
+		return strings.Join(msgs, ", "), nil
+	}
+}
+
+// runOnProjects runs op for each client concurrently with at most `parallel` workers
+// The results are in the same order as clients
+func runOnProjects(ctx context.Context, clients []*Client, parallel int, op ProjectOperation) []*ProjectResult {
+	msgs := make([]string, len(clients))
+	results := make([]*ProjectResult, len(clients))
+	forEachParallel(ctx, len(clients), parallel, func(ctx context.Context, i int) error {
+		msg, err := op(ctx, clients[i])
+		msgs[i] = msg
+		return err
+	}, func(i int, err error) {
+		results[i] = &ProjectResult{
+			ProjectSlug: clients[i].projectSlug,
+			Message:     msgs[i],
+			Err:         err,
+		}
+	})
+	return results
+}
+
+// ProjectResultRecord is a ProjectResult whose error is converted into a string
+type ProjectResultRecord struct {
+	Project string `json:"project" yaml:"project"`
+	Result  string `json:"result" yaml:"result"`
+	Detail  string `json:"detail" yaml:"detail"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// toProjectResultRecords converts results. The succeeded results are reported as planned in dry run.
+func toProjectResultRecords(results []*ProjectResult, dryRun bool) []*ProjectResultRecord {
+	succeeded := ResultSucceeded
+	if dryRun {
+		succeeded = ResultPlanned
+	}
+	rs := make([]*ProjectResultRecord, len(results))
+	for i, r := range results {
+		rs[i] = &ProjectResultRecord{
+			Project: r.ProjectSlug,
+			Result:  succeeded,
+			Detail:  r.Message,
+		}
+		if r.Err != nil {
+			rs[i].Result = ResultFailed
+			rs[i].Error = r.Err.Error()
+		}
+	}
+	return rs
+}
+
+// ApplyToProjects applies op to all the projects of clients after a confirmation
+// The projects are processed concurrently up to Options.Concurrency of the first client.
+// desc describes the operation in the confirmation
+// ErrCancelled is returned if the user cancelled
+func ApplyToProjects(ctx context.Context, clients []*Client, desc string, op ProjectOperation) ([]*ProjectResultRecord, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("apply to projects: there are no target projects")
+	}
+
+	r := &clients[0].reporter
+	r.println(desc)
+	r.println()
+	for _, c := range clients {
+		r.println("  " + c.projectSlug)
+	}
+	r.println()
+	yes, err := clients[0].ui.YesNo("Do you want to apply the change to all the projects?")
+	if err != nil {
+		return nil, fmt.Errorf("apply to projects: %w", err)
+	}
+	if !yes {
+		r.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+
+	results := runOnProjects(ctx, clients, clients[0].opts.concurrency(), op)
+	return toProjectResultRecords(results, clients[0].opts.DryRun), checkProjectResults(results)
+}
+
+// checkProjectResults returns an OperationError if any of results failed
+func checkProjectResults(results []*ProjectResult) error {
+	e := &OperationError{Total: len(results)}
+	for _, r := range results {
+		if r.Err != nil {
+			e.Failed = append(e.Failed, &FailedItem{Name: r.ProjectSlug, Operation: "apply", Err: r.Err})
+		}
+	}
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListFollowedRepos(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	resp, err := httpmock.NewJsonResponder(200, []*followedProject{
+		{Username: "testorg", Reponame: "svc-b", VcsType: "github"},
+		{Username: "testorg", Reponame: "svc-a", VcsType: "github"},
+		{Username: "testorg", Reponame: "web", VcsType: "github"},
+		{Username: "otherorg", Reponame: "svc-c", VcsType: "github"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v1.1/projects", resp)
+
+	cfg := &Config{ApiToken: testAPIToken}
+	got, err := ListFollowedRepos(context.Background(), cfg, "TestOrg", "svc-*", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"svc-a", "svc-b"}, got)
+
+	got, err = ListFollowedRepos(context.Background(), cfg, "testorg", "", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"svc-a", "svc-b", "web"}, got)
+
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v1.1/projects", httpmock.NewStringResponder(500, ""))
+	httpmock.ZeroCallCounters()
+	_, err = ListFollowedRepos(context.Background(), cfg, "testorg", "", Options{MaxAttempts: 1})
+	assert.Error(t, err)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount(), "MaxAttempts should be used")
+}
+
+func TestClient_ForProject(t *testing.T) {
+	c, err := NewClient(&Config{ApiToken: testAPIToken}, "gh/testorg/prj0", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := c.ForProject("gh/testorg/prj1")
+	assert.Equal(t, "gh/testorg/prj1", got.ProjectSlug())
+	assert.Equal(t, "gh/testorg/prj0", c.ProjectSlug())
+	assert.Same(t, c.httpClient, got.httpClient, "The HTTP client should be shared for the rate limits")
+	assert.Same(t, c.ci, got.ci)
+}
+
+func Test_runOnProjects(t *testing.T) {
+	clients := make([]*Client, 10)
+	for i := range clients {
+		clients[i] = &Client{projectSlug: fmt.Sprintf("gh/testorg/prj%d", i)}
+	}
+
+	var running, maxRunning int32
+	op := func(ctx context.Context, c *Client) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if c.projectSlug == "gh/testorg/prj3" {
+			return "", errors.New("failed")
+		}
+		return "done " + c.projectSlug, nil
+	}
+
+	results := runOnProjects(context.Background(), clients, 3, op)
+	assert.LessOrEqual(t, maxRunning, int32(3), "Too many workers ran concurrently")
+	for i, r := range results {
+		assert.Equal(t, clients[i].projectSlug, r.ProjectSlug)
+		if i == 3 {
+			assert.Error(t, r.Err)
+		} else {
+			assert.NoError(t, r.Err)
+			assert.Equal(t, "done "+clients[i].projectSlug, r.Message)
+		}
+	}
+}
+
+func TestPutVariablesOperation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	existing, err := httpmock.NewJsonResponder(200, circleci.ProjectVariable{Name: "FOO", Value: "xxxx_old"})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", apiBaseURL+"/envvar/FOO", existing)
+	httpmock.RegisterResponder("GET", apiBaseURL+"/envvar/BAR", httpmock.NewStringResponder(404, `{"message":"Environment variable not found."}`))
+	created, err := httpmock.NewJsonResponder(201, circleci.ProjectVariable{Name: "FOO", Value: "xxxx_new"})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("POST", apiBaseURL+"/envvar", created)
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+	c := &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		token:       testAPIToken,
+	}
+	op := PutVariablesOperation([]*circleci.ProjectVariable{
+		{Name: "FOO", Value: "new"},
+		{Name: "BAR", Value: "bar"},
+	})
+	msg, err := op(context.Background(), c)
+	assert.NoError(t, err)
+	assert.Equal(t, "updated FOO, created BAR", msg)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST "+apiBaseURL+"/envvar"])
+}
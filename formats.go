@@ -0,0 +1,589 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grezar/go-circleci"
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileType is a format of input files
+type FileType string
+
+const (
+	// FileTypeUnknown detects the format from the file extension or the content
+	FileTypeUnknown FileType = ""
+	FileTypeJson    FileType = "json"
+	FileTypeDotenv  FileType = "dotenv"
+	FileTypeYaml    FileType = "yaml"
+	FileTypeToml    FileType = "toml"
+	FileTypeShell   FileType = "shell"
+	FileTypeAge     FileType = "age"
+	FileTypeSops    FileType = "sops"
+)
+
+// fileFormat is a parser of a format in the registry
+type fileFormat struct {
+	// extensions are the file extensions detected as the format
+	extensions []string
+	// detect reports whether the content looks like the format. It is nil if the format is detected only by the extensions.
+	detect func(body string) bool
+	// parse parses body into variables. keyFile is the path of the age identities for the encrypted formats.
+	parse func(body string, keyFile string) ([]*circleci.ProjectVariable, error)
+}
+
+// fileFormats is the registry of the input formats
+var fileFormats = map[FileType]*fileFormat{
+	FileTypeDotenv: {
+		extensions: []string{".env"},
+		parse:      ignoreKeyFile(parseDotenvToVariables),
+	},
+	FileTypeJson: {
+		extensions: []string{".json"},
+		detect:     looksLikeJson,
+		parse:      ignoreKeyFile(parseJsonToVariables),
+	},
+	FileTypeYaml: {
+		extensions: []string{".yaml", ".yml"},
+		detect:     yamlPattern.MatchString,
+		parse:      ignoreKeyFile(parseYamlToVariables),
+	},
+	FileTypeToml: {
+		extensions: []string{".toml"},
+		detect:     tomlPattern.MatchString,
+		parse:      ignoreKeyFile(parseTomlToVariables),
+	},
+	FileTypeShell: {
+		extensions: []string{".sh", ".bash"},
+		detect:     shellPattern.MatchString,
+		parse:      ignoreKeyFile(parseShellToVariables),
+	},
+	// The encrypted formats are registered in encrypted.go
+}
+
+// encryptedFileTypes are detected from the content before the extensions
+// since encrypted files often have the extensions of the plaintext (e.g. `secrets.enc.yaml`)
+var encryptedFileTypes = []FileType{FileTypeAge, FileTypeSops}
+
+// detectionOrder is the order to detect the plaintext formats from the content which godotenv does not accept
+// Stricter patterns come first. dotenv is used if none of them match.
+var detectionOrder = []FileType{FileTypeJson, FileTypeShell, FileTypeToml, FileTypeYaml}
+
+// fileTypeAliases are the other names accepted by `-t`
+var fileTypeAliases = map[string]FileType{
+	"auto": FileTypeUnknown,
+	"env":  FileTypeDotenv,
+	"yml":  FileTypeYaml,
+	"sh":   FileTypeShell,
+}
+
+func ignoreKeyFile(parse func(body string) ([]*circleci.ProjectVariable, error)) func(string, string) ([]*circleci.ProjectVariable, error) {
+	return func(body string, _ string) ([]*circleci.ProjectVariable, error) {
+		return parse(body)
+	}
+}
+
+var (
+	yamlPattern  = regexp.MustCompile(`(?m)^(---\s*$|[A-Za-z_][A-Za-z0-9_.\-]*:(\s|$))`)
+	tomlPattern  = regexp.MustCompile(`(?m)^\s*\[[A-Za-z0-9_.\-" ]+\]\s*(#.*)?$`)
+	shellPattern = regexp.MustCompile(`(?m)^\s*export\s+[A-Za-z_]`)
+)
+
+func looksLikeJson(body string) bool {
+	s := strings.TrimSpace(body)
+	if strings.HasPrefix(s, "{") {
+		return true
+	}
+	if !strings.HasPrefix(s, "[") {
+		return false
+	}
+	// `[` also starts TOML sections, so the next character is checked
+	s = strings.TrimSpace(s[1:])
+	return strings.HasPrefix(s, "{") || strings.HasPrefix(s, "]")
+}
+
+// validateFormatSpecification returns the file type named filetype
+// FileTypeUnknown is returned for an empty name or `auto` to detect the format
+func validateFormatSpecification(filetype string) (FileType, error) {
+	if ft, ok := fileTypeAliases[filetype]; ok {
+		return ft, nil
+	}
+	ft := FileType(filetype)
+	if ft == FileTypeUnknown {
+		return ft, nil
+	}
+	if _, ok := fileFormats[ft]; !ok {
+		return FileTypeUnknown, fmt.Errorf("unknown file type: %s (allowed: %s)", filetype, strings.Join(fileTypeNames(), ", "))
+	}
+	return ft, nil
+}
+
+// fileTypeNames returns the names of the registered formats in the alphabetical order
+func fileTypeNames() []string {
+	names := make([]string, 0, len(fileFormats))
+	for ft := range fileFormats {
+		names = append(names, string(ft))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectFileType detects the format from the extension of path or body
+// The encrypted formats are detected from the content first.
+// Without a known extension, the content accepted by godotenv is read as dotenv as it was before the other formats were added.
+func detectFileType(path string, body string) FileType {
+	for _, ft := range encryptedFileTypes {
+		if fileFormats[ft].detect(body) {
+			return ft
+		}
+	}
+	if ft := fileTypeByExtension(path); ft != FileTypeUnknown {
+		return ft
+	}
+	if _, err := godotenv.Unmarshal(body); err == nil {
+		return FileTypeDotenv
+	}
+	for _, ft := range detectionOrder {
+		if fileFormats[ft].detect(body) {
+			return ft
+		}
+	}
+	return FileTypeDotenv
+}
+
+// fileTypeByExtension returns the format of the extension of path
+// Dotfiles like `.env.ci` are detected as dotenv.
+func fileTypeByExtension(path string) FileType {
+	if path == "" {
+		return FileTypeUnknown
+	}
+	base := filepath.Base(path)
+	ext := strings.ToLower(filepath.Ext(base))
+	for ft, f := range fileFormats {
+		for _, e := range f.extensions {
+			if ext == e {
+				return ft
+			}
+		}
+	}
+	if strings.HasPrefix(base, ".env") {
+		return FileTypeDotenv
+	}
+	return FileTypeUnknown
+}
+
+// parseVariables parses body in the format of ft
+// keyFile is the path of the age identities for the encrypted formats
+func parseVariables(body string, ft FileType, keyFile string) ([]*circleci.ProjectVariable, error) { // TODO: use original variable type
+	f, ok := fileFormats[ft]
+	if !ok {
+		return nil, fmt.Errorf("no valid file type is specified at parseVariables: %v", ft)
+	}
+	return f.parse(body, keyFile)
+}
+
+// ParseError is an error at a position of malformed input
+type ParseError struct {
+	Format FileType
+	Line   int
+	// Column is the 1-based column in bytes. It is 0 if the column is not known.
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("%s: line %d: %s", e.Format, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: line %d, column %d: %s", e.Format, e.Line, e.Column, e.Msg)
+}
+
+// position returns the 1-based line and column of the byte offset in body
+func position(body string, offset int) (int, int) {
+	if offset > len(body) {
+		offset = len(body)
+	}
+	before := body[:offset]
+	line := strings.Count(before, "\n") + 1
+	return line, offset - strings.LastIndex(before, "\n")
+}
+
+func jsonParseError(body string, err error) error {
+	var offset int64
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &se):
+		offset = se.Offset
+	case errors.As(err, &te):
+		offset = te.Offset
+	default:
+		return err
+	}
+	// The offset is after the byte where the error is found
+	if offset > 0 {
+		offset--
+	}
+	line, col := position(body, int(offset))
+	return &ParseError{Format: FileTypeJson, Line: line, Column: col, Msg: err.Error()}
+}
+
+// parseJsonToVariables parses an array of `{"name": ..., "value": ...}` or an object of names and values
+func parseJsonToVariables(body string) ([]*circleci.ProjectVariable, error) {
+	// TODO: use an original type of ProjectVariable
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		dec := json.NewDecoder(strings.NewReader(body))
+		dec.UseNumber()
+		var mp map[string]interface{}
+		if err := dec.Decode(&mp); err != nil {
+			return nil, fmt.Errorf("parse json to variables: %w", jsonParseError(body, err))
+		}
+		pvs, err := flattenValues(FileTypeJson, mp)
+		if err != nil {
+			return nil, fmt.Errorf("parse json to variables: %w", err)
+		}
+		return pvs, nil
+	}
+	var pvs []*circleci.ProjectVariable
+	if err := json.Unmarshal([]byte(body), &pvs); err != nil {
+		return nil, fmt.Errorf("parse json to variables: %w", jsonParseError(body, err))
+	}
+	return pvs, nil
+}
+
+var (
+	dotenvNameErrorPattern  = regexp.MustCompile(`(?s)^unexpected character (".*?") in variable name near (".*")$`)
+	dotenvQuoteErrorPattern = regexp.MustCompile(`(?s)^unterminated quoted value (.*)$`)
+)
+
+// dotenvParseError locates the error of godotenv in body
+// godotenv does not report positions, but its messages have the source from the error to the end of the input or the line.
+func dotenvParseError(body string, err error) error {
+	// godotenv parses the input with CRLF replaced
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	msg := err.Error()
+	if m := dotenvNameErrorPattern.FindStringSubmatch(msg); m != nil {
+		char, err1 := strconv.Unquote(m[1])
+		near, err2 := strconv.Unquote(m[2])
+		if err1 == nil && err2 == nil && strings.HasSuffix(body, near) {
+			offset := len(body) - len(near)
+			if i := strings.Index(near, char); i >= 0 {
+				offset += i
+			}
+			line, col := position(body, offset)
+			return &ParseError{Format: FileTypeDotenv, Line: line, Column: col, Msg: fmt.Sprintf("unexpected character %q in variable name", char)}
+		}
+	}
+	if m := dotenvQuoteErrorPattern.FindStringSubmatch(msg); m != nil && m[1] != "" {
+		// The value is not terminated until the end of the input, so the last occurrence is the one
+		if i := strings.LastIndex(body, m[1]); i >= 0 {
+			line, col := position(body, i)
+			return &ParseError{Format: FileTypeDotenv, Line: line, Column: col, Msg: "unterminated quoted value"}
+		}
+	}
+	return err
+}
+
+func parseDotenvToVariables(body string) ([]*circleci.ProjectVariable, error) {
+	env, err := godotenv.Unmarshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse dotenv to variables: %w", dotenvParseError(body, err))
+	}
+	pvs := make([]*circleci.ProjectVariable, len(env))
+	i := 0
+	for k, v := range env {
+		pvs[i] = &circleci.ProjectVariable{
+			Name:  k,
+			Value: v,
+		}
+		i++
+	}
+	return pvs, nil
+}
+
+// flattenValues converts a decoded map into variables sorted by the names
+// The keys of nested maps are joined with `_` (e.g. `db: {host: x}` is `db_host=x`). Arrays are not supported.
+func flattenValues(ft FileType, mp map[string]interface{}) ([]*circleci.ProjectVariable, error) {
+	pvs := make([]*circleci.ProjectVariable, 0, len(mp))
+	var flatten func(prefix string, mp map[string]interface{}) error
+	flatten = func(prefix string, mp map[string]interface{}) error {
+		keys := make([]string, 0, len(mp))
+		for k := range mp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := prefix + k
+			switch v := mp[k].(type) {
+			case map[string]interface{}:
+				if err := flatten(name+"_", v); err != nil {
+					return err
+				}
+			case []interface{}:
+				return fmt.Errorf("%s: %s: arrays are not supported", ft, name)
+			case nil:
+				pvs = append(pvs, &circleci.ProjectVariable{Name: name, Value: ""})
+			case float64:
+				pvs = append(pvs, &circleci.ProjectVariable{Name: name, Value: strconv.FormatFloat(v, 'f', -1, 64)})
+			default:
+				pvs = append(pvs, &circleci.ProjectVariable{Name: name, Value: fmt.Sprint(v)})
+			}
+		}
+		return nil
+	}
+	if err := flatten("", mp); err != nil {
+		return nil, err
+	}
+	return pvs, nil
+}
+
+// yamlErrorPattern matches the position in the syntax errors of yaml.v3
+var yamlErrorPattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func yamlParseError(err error) error {
+	m := yamlErrorPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	return &ParseError{Format: FileTypeYaml, Line: line, Msg: m[2]}
+}
+
+// parseYamlToVariables parses a map of names and values like `FOO: bar`
+// The keys of nested maps are joined with `_` in the same way as flattenValues.
+func parseYamlToVariables(body string) ([]*circleci.ProjectVariable, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, fmt.Errorf("parse yaml to variables: %w", yamlParseError(err))
+	}
+	pvs := make([]*circleci.ProjectVariable, 0)
+	if len(doc.Content) == 0 {
+		return pvs, nil
+	}
+	var flatten func(prefix string, n *yaml.Node) error
+	flatten = func(prefix string, n *yaml.Node) error {
+		if n.Kind != yaml.MappingNode {
+			return &ParseError{Format: FileTypeYaml, Line: n.Line, Column: n.Column, Msg: "a map of names and values is expected"}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			name := prefix + k.Value
+			switch v.Kind {
+			case yaml.MappingNode:
+				if err := flatten(name+"_", v); err != nil {
+					return err
+				}
+			case yaml.ScalarNode:
+				value := v.Value
+				if v.Tag == "!!null" {
+					value = ""
+				}
+				pvs = append(pvs, &circleci.ProjectVariable{Name: name, Value: value})
+			default:
+				return &ParseError{Format: FileTypeYaml, Line: v.Line, Column: v.Column, Msg: fmt.Sprintf("%s: only scalars and maps are supported", name)}
+			}
+		}
+		return nil
+	}
+	if err := flatten("", doc.Content[0]); err != nil {
+		return nil, fmt.Errorf("parse yaml to variables: %w", err)
+	}
+	return pvs, nil
+}
+
+// parseTomlToVariables parses TOML whose keys in sections are prefixed by the section names (e.g. `[db] host = "x"` is `db_host=x`)
+func parseTomlToVariables(body string) ([]*circleci.ProjectVariable, error) {
+	var mp map[string]interface{}
+	if err := toml.Unmarshal([]byte(body), &mp); err != nil {
+		var de *toml.DecodeError
+		if errors.As(err, &de) {
+			line, col := de.Position()
+			err = &ParseError{Format: FileTypeToml, Line: line, Column: col, Msg: strings.TrimPrefix(de.Error(), "toml: ")}
+		}
+		return nil, fmt.Errorf("parse toml to variables: %w", err)
+	}
+	pvs, err := flattenValues(FileTypeToml, mp)
+	if err != nil {
+		return nil, fmt.Errorf("parse toml to variables: %w", err)
+	}
+	return pvs, nil
+}
+
+// shellParser parses shell snippets of assignments like `export FOO=bar`
+// Quotes, backslash escapes and comments are handled as in sh. Expansions (`$FOO`, `$(cmd)` and backquotes) are rejected since they are not evaluated.
+type shellParser struct {
+	body string
+	pos  int
+}
+
+func (p *shellParser) errorf(offset int, format string, args ...interface{}) error {
+	line, col := position(p.body, offset)
+	return &ParseError{Format: FileTypeShell, Line: line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *shellParser) eof() bool {
+	return p.pos >= len(p.body)
+}
+
+func (p *shellParser) peek() byte {
+	return p.body[p.pos]
+}
+
+// skipBlanks skips spaces, and also newlines and comments if lines is true
+func (p *shellParser) skipBlanks(lines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case lines && (c == '\n' || c == ';'):
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isShellNameChar(c byte, first bool) bool {
+	return c == '_' || ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || (!first && '0' <= c && c <= '9')
+}
+
+func (p *shellParser) name() string {
+	start := p.pos
+	for !p.eof() && isShellNameChar(p.peek(), p.pos == start) {
+		p.pos++
+	}
+	return p.body[start:p.pos]
+}
+
+// value reads a word until an unquoted blank, newline or `;`
+func (p *shellParser) value() (string, error) {
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch c {
+		case ' ', '\t', '\r', '\n', ';':
+			return sb.String(), nil
+		case '\'':
+			start := p.pos
+			end := strings.IndexByte(p.body[p.pos+1:], '\'')
+			if end < 0 {
+				return "", p.errorf(start, "unterminated single quote")
+			}
+			sb.WriteString(p.body[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case '"':
+			if err := p.doubleQuoted(&sb); err != nil {
+				return "", err
+			}
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return sb.String(), nil
+			}
+			if p.peek() != '\n' {
+				sb.WriteByte(p.peek())
+			}
+			p.pos++
+		case '$', '`':
+			return "", p.errorf(p.pos, "expansions are not supported")
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return sb.String(), nil
+}
+
+func (p *shellParser) doubleQuoted(sb *strings.Builder) error {
+	start := p.pos
+	p.pos++
+	for !p.eof() {
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return nil
+		case '\\':
+			p.pos++
+			if p.eof() {
+				continue
+			}
+			switch n := p.peek(); n {
+			case '$', '`', '"', '\\':
+				sb.WriteByte(n)
+			case '\n':
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(n)
+			}
+			p.pos++
+		case '$', '`':
+			return p.errorf(p.pos, "expansions are not supported")
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return p.errorf(start, "unterminated double quote")
+}
+
+// assignment reads `[export] NAME=value`
+func (p *shellParser) assignment() (*circleci.ProjectVariable, error) {
+	start := p.pos
+	name := p.name()
+	if name == "export" && !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipBlanks(false)
+		start = p.pos
+		name = p.name()
+	}
+	if name == "" {
+		return nil, p.errorf(start, "a variable name is expected")
+	}
+	if p.eof() || p.peek() != '=' {
+		return nil, p.errorf(p.pos, "`=` is expected after %s", name)
+	}
+	p.pos++
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlanks(false)
+	if !p.eof() && p.peek() != '\n' && p.peek() != ';' {
+		return nil, p.errorf(p.pos, "unexpected characters after the value of %s", name)
+	}
+	return &circleci.ProjectVariable{Name: name, Value: value}, nil
+}
+
+// parseShellToVariables parses shell snippets like `export FOO=bar`
+// The later assignments of the same name win as in sh.
+func parseShellToVariables(body string) ([]*circleci.ProjectVariable, error) {
+	p := &shellParser{body: body}
+	pvs := make([]*circleci.ProjectVariable, 0)
+	index := make(map[string]int)
+	for p.skipBlanks(true); !p.eof(); p.skipBlanks(true) {
+		pv, err := p.assignment()
+		if err != nil {
+			return nil, fmt.Errorf("parse shell to variables: %w", err)
+		}
+		if i, prs := index[pv.Name]; prs {
+			pvs[i] = pv
+			continue
+		}
+		index[pv.Name] = len(pvs)
+		pvs = append(pvs, pv)
+	}
+	return pvs, nil
+}
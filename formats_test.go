@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+func Test_validateFormatSpecification(t *testing.T) {
+	tests := []struct {
+		filetype string
+		want     FileType
+		wantErr  bool
+	}{
+		{"", FileTypeUnknown, false},
+		{"auto", FileTypeUnknown, false},
+		{"json", FileTypeJson, false},
+		{"yml", FileTypeYaml, false},
+		{"toml", FileTypeToml, false},
+		{"sh", FileTypeShell, false},
+		{"sops", FileTypeSops, false},
+		{"xml", FileTypeUnknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filetype, func(t *testing.T) {
+			got, err := validateFormatSpecification(tt.filetype)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_detectFileType(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want FileType
+	}{
+		{"json extension", "envs.json", "", FileTypeJson},
+		{"yml extension", "config/env.yml", "", FileTypeYaml},
+		{"toml extension", "env.toml", "", FileTypeToml},
+		{"shell extension", "env.sh", "FOO=bar", FileTypeShell},
+		{"dotenv file", ".env.ci", "FOO: bar", FileTypeDotenv},
+		{"sops with yaml extension", "secrets.enc.yaml", "FOO: ENC[AES256_GCM,data:x,iv:y,tag:z,type:str]", FileTypeSops},
+		{"age content", "", "age-encryption.org/v1\n", FileTypeAge},
+		{"json array", "", `[{"name": "FOO", "value": "bar"}]`, FileTypeJson},
+		{"json object", "", `{"FOO": "bar"}`, FileTypeJson},
+		{"toml section", "", "[app]\nFOO = \"bar\"\n", FileTypeToml},
+		{"yaml document", "", "---\nFOO: bar\n", FileTypeYaml},
+		{"shell script", "vars", "# comment\nset -e\nexport FOO=bar\n", FileTypeShell},
+		{"yaml map accepted by dotenv", "", "FOO: bar\n", FileTypeDotenv},
+		{"shell export accepted by dotenv", "vars", "export FOO=bar\n", FileTypeDotenv},
+		{"shell export with expansion", "", "export FOO=$BAR\n", FileTypeDotenv},
+		{"dotenv fallback", "", "FOO=bar\n", FileTypeDotenv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectFileType(tt.path, tt.body))
+		})
+	}
+}
+
+func Test_parseVariables(t *testing.T) {
+	tests := []struct {
+		name string
+		ft   FileType
+		body string
+		want []*circleci.ProjectVariable
+	}{
+		{
+			name: "json object",
+			ft:   FileTypeJson,
+			body: `{"FOO": "bar", "PORT": 8080, "DEBUG": true, "EMPTY": null, "DB": {"HOST": "localhost"}}`,
+			want: []*circleci.ProjectVariable{
+				{Name: "DB_HOST", Value: "localhost"},
+				{Name: "DEBUG", Value: "true"},
+				{Name: "EMPTY", Value: ""},
+				{Name: "FOO", Value: "bar"},
+				{Name: "PORT", Value: "8080"},
+			},
+		},
+		{
+			name: "yaml",
+			ft:   FileTypeYaml,
+			body: "FOO: bar\nPORT: 8080\nDB:\n  HOST: localhost\nEMPTY:\n",
+			want: []*circleci.ProjectVariable{
+				{Name: "FOO", Value: "bar"},
+				{Name: "PORT", Value: "8080"},
+				{Name: "DB_HOST", Value: "localhost"},
+				{Name: "EMPTY", Value: ""},
+			},
+		},
+		{
+			name: "empty yaml",
+			ft:   FileTypeYaml,
+			body: "",
+			want: []*circleci.ProjectVariable{},
+		},
+		{
+			name: "toml",
+			ft:   FileTypeToml,
+			body: "FOO = \"bar\"\nRATE = 0.5\n\n[DB]\nHOST = \"localhost\"\nPORT = 5432\n",
+			want: []*circleci.ProjectVariable{
+				{Name: "DB_HOST", Value: "localhost"},
+				{Name: "DB_PORT", Value: "5432"},
+				{Name: "FOO", Value: "bar"},
+				{Name: "RATE", Value: "0.5"},
+			},
+		},
+		{
+			name: "shell",
+			ft:   FileTypeShell,
+			body: "#!/bin/sh\nexport FOO=bar # comment\nexport QUOTED='a b $c'; BAR=\"x \\\"y\\\" \\$z\"\nJOINED=a'b'\"c\"\nFOO=baz\n",
+			want: []*circleci.ProjectVariable{
+				{Name: "FOO", Value: "baz"},
+				{Name: "QUOTED", Value: "a b $c"},
+				{Name: "BAR", Value: `x "y" $z`},
+				{Name: "JOINED", Value: "abc"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVariables(tt.body, tt.ft, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseVariables_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		ft      FileType
+		body    string
+		wantErr *ParseError
+	}{
+		{
+			name:    "json syntax",
+			ft:      FileTypeJson,
+			body:    "{\n  \"FOO\": \"bar\",\n  \"BAR\" \"baz\"\n}",
+			wantErr: &ParseError{Format: FileTypeJson, Line: 3, Column: 9},
+		},
+		{
+			name:    "yaml syntax",
+			ft:      FileTypeYaml,
+			body:    "FOO: bar\nBAR: baz: qux\n",
+			wantErr: &ParseError{Format: FileTypeYaml, Line: 2},
+		},
+		{
+			name:    "yaml sequence",
+			ft:      FileTypeYaml,
+			body:    "FOO: bar\nBAR:\n  - baz\n",
+			wantErr: &ParseError{Format: FileTypeYaml, Line: 3, Column: 3},
+		},
+		{
+			name:    "toml syntax",
+			ft:      FileTypeToml,
+			body:    "FOO = \"bar\"\nBAR = baz\n",
+			wantErr: &ParseError{Format: FileTypeToml, Line: 2, Column: 7},
+		},
+		{
+			name:    "shell expansion",
+			ft:      FileTypeShell,
+			body:    "export FOO=bar\nexport BAR=\"${FOO}\"\n",
+			wantErr: &ParseError{Format: FileTypeShell, Line: 2, Column: 13},
+		},
+		{
+			name:    "shell unterminated quote",
+			ft:      FileTypeShell,
+			body:    "FOO='bar\n",
+			wantErr: &ParseError{Format: FileTypeShell, Line: 1, Column: 5},
+		},
+		{
+			name:    "shell command",
+			ft:      FileTypeShell,
+			body:    "FOO=bar\necho $FOO\n",
+			wantErr: &ParseError{Format: FileTypeShell, Line: 2, Column: 5},
+		},
+		{
+			name:    "dotenv variable name",
+			ft:      FileTypeDotenv,
+			body:    "FOO=bar\r\n  BA-R=baz\n",
+			wantErr: &ParseError{Format: FileTypeDotenv, Line: 2, Column: 5},
+		},
+		{
+			name:    "dotenv unterminated quote",
+			ft:      FileTypeDotenv,
+			body:    "FOO=bar\nBAR=\"baz\nQUX=qux\n",
+			wantErr: &ParseError{Format: FileTypeDotenv, Line: 2, Column: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseVariables(tt.body, tt.ft, "")
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("ParseError is expected: %v", err)
+			}
+			assert.Equal(t, tt.wantErr.Format, pe.Format)
+			assert.Equal(t, tt.wantErr.Line, pe.Line, pe.Error())
+			assert.Equal(t, tt.wantErr.Column, pe.Column, pe.Error())
+		})
+	}
+}
+
+func Test_parseVariables_arrays(t *testing.T) {
+	_, err := parseVariables(`{"FOO": ["a", "b"]}`, FileTypeJson, "")
+	assert.EqualError(t, err, "parse json to variables: json: FOO: arrays are not supported")
+	_, err = parseVariables("[DB]\nHOSTS = [\"a\"]\n", FileTypeToml, "")
+	assert.EqualError(t, err, "parse toml to variables: toml: DB_HOSTS: arrays are not supported")
+}
+
+func Test_readVariables_detect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.yaml")
+	if err := os.WriteFile(path, []byte("FOO: bar\nBAR: baz: qux\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := readVariables(nil, "", path, "")
+	assert.EqualError(t, err, path+": parse yaml to variables: yaml: line 2: mapping values are not allowed in this context")
+
+	if err := os.WriteFile(path, []byte("FOO: bar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readVariables(nil, "", path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*circleci.ProjectVariable{{Name: "FOO", Value: "bar"}}, got)
+}
+
+func Test_readVariables_stdin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().ReadAll(gomock.Any()).Return("BAR=baz\nexport FOO=$BAR\n", nil)
+	got, err := readVariables(ui, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []*circleci.ProjectVariable{{Name: "BAR", Value: "baz"}, {Name: "FOO", Value: "baz"}}, got)
+}
+
+// Test_detectFileType_dotenv confirms that the input accepted by dotenv without `-t` is read in the same way as before the detection
+func Test_detectFileType_dotenv(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []*circleci.ProjectVariable
+	}{
+		{"escaped newline in an export", "export FOO=\"line1\\nline2\"\n", []*circleci.ProjectVariable{{Name: "FOO", Value: "line1\nline2"}}},
+		{"colon in a yaml style value", "FOO: a: b\n", []*circleci.ProjectVariable{{Name: "FOO", Value: "a: b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVariables(tt.body, detectFileType("", tt.body), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// VariableRecord is a variable of a project
+type VariableRecord struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// ResultRecord is a result of an operation for a variable or a resource
+type ResultRecord struct {
+	Name      string `json:"name" yaml:"name"`
+	Operation string `json:"operation" yaml:"operation"`
+	Result    string `json:"result" yaml:"result"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	err error
+}
+
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+	ResultSkipped   = "skipped"
+	// ResultPlanned is the result of operations which are not applied in dry run
+	ResultPlanned = "planned"
+)
+
+func newResultRecord(name string, operation string, err error) *ResultRecord {
+	r := &ResultRecord{
+		Name:      name,
+		Operation: operation,
+		Result:    ResultSucceeded,
+	}
+	if err != nil {
+		r.Result = ResultFailed
+		r.Error = err.Error()
+		r.err = err
+	}
+	return r
+}
+
+// reporter writes progress messages and previews of confirmations
+// The zero value discards the messages
+type reporter struct {
+	w io.Writer
+}
+
+func newReporter(w io.Writer) reporter {
+	return reporter{w: w}
+}
+
+func (r *reporter) info() io.Writer {
+	if r.w == nil {
+		return io.Discard
+	}
+	return r.w
+}
+
+func (r *reporter) printf(format string, a ...interface{}) {
+	fmt.Fprintf(r.info(), format, a...)
+}
+
+func (r *reporter) println(a ...interface{}) {
+	fmt.Fprintln(r.info(), a...)
+}
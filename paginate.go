@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+)
+
+// pageFetcher fetches a single page specified by pageToken.
+// pageToken is nil for the first page.
+// It returns the items of the page and the token of the next page (empty if it is the last page).
+type pageFetcher[T any] func(ctx context.Context, pageToken *string) ([]T, string, error)
+
+// listAllPages follows NextPageToken until all the items are fetched.
+func listAllPages[T any](ctx context.Context, fetch pageFetcher[T]) ([]T, error) {
+	items := make([]T, 0)
+	seen := make(map[string]bool)
+	var token *string
+	for {
+		page, next, err := fetch(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if next == "" {
+			return items, nil
+		}
+		if seen[next] {
+			return nil, fmt.Errorf("list all pages: page token %q is returned twice", next)
+		}
+		seen[next] = true
+		token = &next
+	}
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency is the number of API calls sent at once in bulk operations if Options.Concurrency is not set
+const DefaultConcurrency = 4
+
+func (o Options) concurrency() int {
+	if o.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+	return o.Concurrency
+}
+
+// forEachParallel calls do for each of n items concurrently with at most `parallel` workers
+// report is called in the order of the items from the calling goroutine so that messages are deterministic.
+// Items which are not started before ctx is done are reported with ctx.Err() without calling do.
+func forEachParallel(ctx context.Context, n int, parallel int, do func(ctx context.Context, i int) error, report func(i int, err error)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	errs := make([]error, n)
+	done := make([]chan struct{}, n)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+				} else {
+					errs[i] = do(ctx, i)
+				}
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			idx <- i
+		}
+		close(idx)
+	}()
+	for i := 0; i < n; i++ {
+		<-done[i]
+		report(i, errs[i])
+	}
+	wg.Wait()
+}
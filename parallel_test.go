@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_forEachParallel(t *testing.T) {
+	const n = 20
+	var running, maxRunning int32
+	var reported []int
+	errs := make([]error, n)
+	forEachParallel(context.Background(), n, 4, func(ctx context.Context, i int) error {
+		c := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if c <= m || atomic.CompareAndSwapInt32(&maxRunning, m, c) {
+				break
+			}
+		}
+		// Later items finish earlier
+		time.Sleep(time.Duration(n-i) * time.Millisecond)
+		if i == 5 {
+			return errors.New("failed")
+		}
+		return nil
+	}, func(i int, err error) {
+		reported = append(reported, i)
+		errs[i] = err
+	})
+
+	assert.LessOrEqual(t, maxRunning, int32(4), "Too many workers ran concurrently")
+	want := make([]int, n)
+	for i := range want {
+		want[i] = i
+	}
+	assert.Equal(t, want, reported, "results are reported in the order of the items")
+	for i, err := range errs {
+		if i == 5 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func Test_forEachParallel_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var called int32
+	errs := make([]error, 10)
+	forEachParallel(ctx, 10, 2, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&called, 1)
+		if i == 1 {
+			cancel()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(i int, err error) {
+		errs[i] = err
+	})
+
+	assert.LessOrEqual(t, called, int32(4), "items are not started after cancellation")
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// operation is a write call planned by clients
+// Planning and executing are separated so that the calls can be skipped in dry run
+type operation struct {
+	// kind is the operation of the results. e.g. create, delete
+	kind string
+	name string
+	// value is the new value of the variable for the audit log
+	value string
+	call  func(ctx context.Context) error
+}
+
+// doneMessages are the message prefixes of succeeded operations
+var doneMessages = map[string]string{
+	"create": "Created",
+	"delete": "Deleted",
+}
+
+// planned returns the result of an operation skipped in dry run
+func (r *reporter) planned(kind string, name string) *ResultRecord {
+	r.printf("Would %s: %s\n", kind, name)
+	return &ResultRecord{Name: name, Operation: kind, Result: ResultPlanned}
+}
+
+// executeOperations calls ops concurrently and continues even if some of them fail
+// The returned results correspond to ops by index, and the messages are written in the same order.
+// With the DryRun option, no calls are made and ops are reported as planned.
+func executeOperations(ctx context.Context, opts Options, r *reporter, ops []*operation) []*ResultRecord {
+	rs := make([]*ResultRecord, len(ops))
+	if opts.DryRun {
+		for i, op := range ops {
+			rs[i] = r.planned(op.kind, op.name)
+		}
+		return rs
+	}
+	forEachParallel(ctx, len(ops), opts.concurrency(), func(ctx context.Context, i int) error {
+		return ops[i].call(ctx)
+	}, func(i int, err error) {
+		op := ops[i]
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"key":   op.name,
+				"error": err,
+			}).Errorf("Failed to %s. Continue.", op.kind)
+		} else {
+			r.printf("%s: %s\n", doneMessages[op.kind], op.name)
+		}
+		rs[i] = newResultRecord(op.name, op.kind, err)
+	})
+	return rs
+}
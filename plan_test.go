@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_executeOperations(t *testing.T) {
+	var called []string
+	ops := []*operation{
+		{kind: "create", name: "FOO", call: func(ctx context.Context) error {
+			called = append(called, "FOO")
+			return nil
+		}},
+		{kind: "delete", name: "BAR", call: func(ctx context.Context) error {
+			called = append(called, "BAR")
+			return errors.New("failed")
+		}},
+	}
+
+	var buf bytes.Buffer
+	r := newReporter(&buf)
+	rs := executeOperations(context.Background(), Options{Concurrency: 1}, &r, ops)
+	assert.Equal(t, []string{"FOO", "BAR"}, called)
+	assert.Equal(t, ResultSucceeded, rs[0].Result)
+	assert.Equal(t, ResultFailed, rs[1].Result)
+	assert.Equal(t, "Created: FOO\n", buf.String())
+
+	called = nil
+	buf.Reset()
+	rs = executeOperations(context.Background(), Options{DryRun: true}, &r, ops)
+	assert.Empty(t, called, "no calls are made in dry run")
+	assert.Equal(t, []*ResultRecord{
+		{Name: "FOO", Operation: "create", Result: ResultPlanned},
+		{Name: "BAR", Operation: "delete", Result: ResultPlanned},
+	}, rs)
+	assert.Equal(t, "Would create: FOO\nWould delete: BAR\n", buf.String())
+}
@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RestrictionType is a type of context restrictions
+type RestrictionType string
+
+const (
+	RestrictionTypeProject    RestrictionType = "project"
+	RestrictionTypeExpression RestrictionType = "expression"
+	RestrictionTypeGroup      RestrictionType = "group"
+)
+
+func validateRestrictionType(t string) (RestrictionType, error) {
+	switch rt := RestrictionType(t); rt {
+	case RestrictionTypeProject, RestrictionTypeExpression, RestrictionTypeGroup:
+		return rt, nil
+	}
+	return "", fmt.Errorf("invalid restriction type: %s (allowed: project, expression, group)", t)
+}
+
+type contextRestriction struct {
+	ID               string          `json:"id"`
+	ContextID        string          `json:"context_id"`
+	ProjectID        string          `json:"project_id,omitempty"`
+	Name             string          `json:"name,omitempty"`
+	RestrictionType  RestrictionType `json:"restriction_type"`
+	RestrictionValue string          `json:"restriction_value"`
+}
+
+type contextRestrictionList struct {
+	Items         []*contextRestriction `json:"items"`
+	NextPageToken string                `json:"next_page_token"`
+}
+
+type contextRestrictionCreateOptions struct {
+	RestrictionType  RestrictionType `json:"restriction_type"`
+	RestrictionValue string          `json:"restriction_value"`
+}
+
+func (c *ContextClient) restrictionsURL(contextID string) string {
+	return fmt.Sprintf("%s/context/%s/restrictions", apiBase(c.baseURL), contextID)
+}
+
+func (c *ContextClient) listAllRestrictions(ctx context.Context, contextID string) ([]*contextRestriction, error) {
+	rs, err := listAllPages(ctx, func(ctx context.Context, token *string) ([]*contextRestriction, string, error) {
+		u := c.restrictionsURL(contextID)
+		if token != nil {
+			u += "?page-token=" + url.QueryEscape(*token)
+		}
+		body, err := requestURL(ctx, c.httpClient, c.token, u)
+		if err != nil {
+			return nil, "", err
+		}
+		var rl contextRestrictionList
+		if err := json.Unmarshal(body, &rl); err != nil {
+			return nil, "", err
+		}
+		return rl.Items, rl.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing all restrictions: %w", err)
+	}
+	return rs, nil
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// resolveProjectID converts `<org>/<repo>` or `<repo>` into the project ID
+// A value which is already a project ID is returned as it is
+func (c *ContextClient) resolveProjectID(ctx context.Context, v string) (string, error) {
+	if uuidPattern.MatchString(v) {
+		return v, nil
+	}
+	vcs := strings.SplitN(c.ownerSlug, "/", 2)[0]
+	slug := vcs + "/" + v
+	if !strings.Contains(v, "/") {
+		slug = c.ownerSlug + "/" + v
+	}
+	prj, err := c.ci.Projects.Get(ctx, slug)
+	if err != nil {
+		return "", fmt.Errorf("resolve project id of %s: %w", slug, err)
+	}
+	return prj.ID, nil
+}
+
+func getMaxRestrictionIDLength(rs []*contextRestriction) int {
+	maxlen := 0
+	for _, r := range rs {
+		if len(r.ID) > maxlen {
+			maxlen = len(r.ID)
+		}
+	}
+	return maxlen
+}
+
+func restrictionString(r *contextRestriction, maxlen int) string {
+	desc := r.RestrictionValue
+	if r.Name != "" {
+		desc = fmt.Sprintf("%s (%s)", r.RestrictionValue, r.Name)
+	}
+	return fmt.Sprintf("%-*s %-10s %s", maxlen, r.ID, r.RestrictionType, desc)
+}
+
+func dumpRestrictions(w io.Writer, rs []*contextRestriction) {
+	maxlen := getMaxRestrictionIDLength(rs)
+	for _, r := range rs {
+		fmt.Fprintln(w, restrictionString(r, maxlen))
+	}
+}
+
+func convertRestrictionsToString(rs []*contextRestriction) []string {
+	maxlen := getMaxRestrictionIDLength(rs)
+	res := make([]string, len(rs))
+	for i, r := range rs {
+		res[i] = restrictionString(r, maxlen)
+	}
+	return res
+}
+
+func (c *ContextClient) ListRestrictions(ctx context.Context, name string) ([]*RestrictionRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("list restrictions: %w", err)
+	}
+	rs, err := c.listAllRestrictions(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list restrictions: %w", err)
+	}
+	if len(rs) == 0 {
+		c.printf("Context %s has no restrictions.\n", cx.Name)
+	}
+	return toRestrictionRecords(rs), nil
+}
+
+// RestrictionRecord is a restriction of a context
+type RestrictionRecord struct {
+	ID    string          `json:"id" yaml:"id"`
+	Type  RestrictionType `json:"type" yaml:"type"`
+	Value string          `json:"value" yaml:"value"`
+	Name  string          `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+func toRestrictionRecords(rs []*contextRestriction) []*RestrictionRecord {
+	records := make([]*RestrictionRecord, len(rs))
+	for i, r := range rs {
+		records[i] = &RestrictionRecord{
+			ID:    r.ID,
+			Type:  r.RestrictionType,
+			Value: r.RestrictionValue,
+			Name:  r.Name,
+		}
+	}
+	return records
+}
+
+// AddRestriction restricts a context
+// For project restrictions, the value can be `<org>/<repo>`, `<repo>` or the project ID
+// ErrCancelled is returned if the user cancelled
+func (c *ContextClient) AddRestriction(ctx context.Context, name string, restrictionType string, value string) (*ResultRecord, error) {
+	rt, err := validateRestrictionType(restrictionType)
+	if err != nil {
+		return nil, fmt.Errorf("add restriction: %w", err)
+	}
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("add restriction: %w", err)
+	}
+	if rt == RestrictionTypeProject {
+		value, err = c.resolveProjectID(ctx, value)
+		if err != nil {
+			return nil, fmt.Errorf("add restriction: %w", err)
+		}
+	}
+
+	c.printf("A %s restriction `%s` will be added to %s.\n", rt, value, cx.Name)
+	c.println("Jobs which do not satisfy the restrictions will not be able to use the context.")
+	c.println()
+	yes, err := c.ui.YesNo("Do you want to continue?")
+	if err != nil {
+		return nil, fmt.Errorf("add restriction: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+	if c.opts.DryRun {
+		return c.planned("create", value), nil
+	}
+
+	opts := contextRestrictionCreateOptions{
+		RestrictionType:  rt,
+		RestrictionValue: value,
+	}
+	body, err := doRequest(ctx, c.httpClient, c.token, "POST", c.restrictionsURL(cx.ID), opts)
+	if err != nil {
+		return nil, fmt.Errorf("add restriction: %w", err)
+	}
+	var r contextRestriction
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("add restriction: %w", err)
+	}
+	c.printf("Created: %s\n", r.ID)
+	return newResultRecord(r.ID, "create", nil), nil
+}
+
+func (c *ContextClient) deleteRestrictions(ctx context.Context, contextID string, dels []*contextRestriction) ([]*ResultRecord, error) {
+	if len(dels) == 0 {
+		return nil, fmt.Errorf("no restrictions are specified")
+	}
+
+	c.println("These restrictions will be removed.")
+	c.println()
+	dumpRestrictions(c.info(), dels)
+	c.println()
+
+	yes, err := c.ui.YesNo("Do you want to continue?")
+	if err != nil {
+		return nil, fmt.Errorf("delete restrictions: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+
+	ops := make([]*operation, len(dels))
+	for i, r := range dels {
+		u := c.restrictionsURL(contextID) + "/" + r.ID
+		ops[i] = &operation{kind: "delete", name: r.ID, call: func(ctx context.Context) error {
+			_, err := doRequest(ctx, c.httpClient, c.token, "DELETE", u, nil)
+			return err
+		}}
+	}
+	rs := executeOperations(ctx, c.opts, &c.reporter, ops)
+	return rs, checkResults(rs)
+}
+
+func (c *ContextClient) DeleteRestrictionsInteractive(ctx context.Context, name string) ([]*ResultRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("delete restrictions: %w", err)
+	}
+	rs, err := c.listAllRestrictions(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("delete restrictions: %w", err)
+	}
+	srs := convertRestrictionsToString(rs)
+	sel, err := c.ui.SelectFromList("Choose restrictions to be deleted.", srs)
+	if err != nil {
+		return nil, fmt.Errorf("delete restrictions: %w", err)
+	}
+
+	rrm := makeReverseResolutionMap(srs)
+	dels := make([]*contextRestriction, len(sel))
+	for i, s := range sel {
+		dels[i] = rs[rrm[s]]
+	}
+	return c.deleteRestrictions(ctx, cx.ID, dels)
+}
+
+// DeleteRestrictions deletes restrictions of a context by IDs
+// Restrictions not found are reported as skipped results
+func (c *ContextClient) DeleteRestrictions(ctx context.Context, name string, ids []string) ([]*ResultRecord, error) {
+	cx, err := c.getContextByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("delete restrictions: %w", err)
+	}
+	rs, err := c.listAllRestrictions(ctx, cx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("delete restrictions: %w", err)
+	}
+	mp := make(map[string]*contextRestriction)
+	for _, r := range rs {
+		mp[r.ID] = r
+	}
+	dels := make([]*contextRestriction, 0)
+	nonDels := make([]string, 0)
+	for _, id := range ids {
+		if r, prs := mp[id]; prs {
+			dels = append(dels, r)
+		} else {
+			nonDels = append(nonDels, id)
+		}
+	}
+	dumpNames(c.info(), "These restrictions are not found.", nonDels)
+	skipped := notFoundRecords(nonDels, "delete")
+	if len(dels) == 0 {
+		c.println("There are no deleted restrictions.")
+		return skipped, nil
+	}
+	results, err := c.deleteRestrictions(ctx, cx.ID, dels)
+	if results == nil {
+		return nil, err
+	}
+	return append(results, skipped...), err
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+func TestContextClient_AddRestriction(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	prjID := "00000000-0000-0000-0000-0000000000aa"
+	prjResp, err := httpmock.NewJsonResponder(200, circleci.Project{ID: prjID, Slug: projectSlug})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v2/project/"+projectSlug, prjResp)
+
+	var got contextRestrictionCreateOptions
+	expectedURL := contextBaseURL + "/" + testContextID + "/restrictions"
+	httpmock.RegisterResponder("POST", expectedURL, func(r *http.Request) (*http.Response, error) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			return httpmock.NewStringResponse(500, err.Error()), nil
+		}
+		return httpmock.NewJsonResponse(201, contextRestriction{ID: "r1", ContextID: testContextID})
+	})
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+	c := setupContextClient(t, ui)
+
+	if _, err := c.AddRestriction(context.Background(), "shared", "project", "testprj"); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, contextRestrictionCreateOptions{RestrictionType: RestrictionTypeProject, RestrictionValue: prjID}, got)
+
+	_, err = c.AddRestriction(context.Background(), "shared", "unknown", "value")
+	assert.Error(t, err)
+}
+
+func TestContextClient_DeleteRestrictions(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	listURL := contextBaseURL + "/" + testContextID + "/restrictions"
+	resp, err := httpmock.NewJsonResponder(200, contextRestrictionList{
+		Items: []*contextRestriction{
+			{ID: "r1", ContextID: testContextID, RestrictionType: RestrictionTypeGroup, RestrictionValue: "g1"},
+			{ID: "r2", ContextID: testContextID, RestrictionType: RestrictionTypeExpression, RestrictionValue: `pipeline.git.branch == "main"`},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", listURL, resp)
+	httpmock.RegisterResponder("DELETE", listURL+"/r2", httpmock.NewStringResponder(200, `{"message":"OK"}`))
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+	c := setupContextClient(t, ui)
+
+	if _, err := c.DeleteRestrictions(context.Background(), "shared", []string{"r2", "r3"}); err != nil {
+		t.Error(err)
+	}
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["DELETE "+listURL+"/r2"], "Expected number of delete API call is wrong")
+	assert.Equal(t, 0, info["DELETE "+listURL+"/r1"], "Expected number of delete API call is wrong")
+}
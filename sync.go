@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/grezar/go-circleci"
+)
+
+type syncPlan struct {
+	adds    []*circleci.ProjectVariable
+	updates []*circleci.ProjectVariable
+	removes []*circleci.ProjectVariable
+}
+
+func (p *syncPlan) empty() bool {
+	return len(p.adds) == 0 && len(p.updates) == 0 && len(p.removes) == 0
+}
+
+func sortVariables(pvs []*circleci.ProjectVariable) {
+	sort.Slice(pvs, func(i, j int) bool {
+		return pvs[i].Name < pvs[j].Name
+	})
+}
+
+// makeSyncPlan computes operations to make the remote variables match the local ones.
+// Variables existing on both sides are always updated since the remote values are masked.
+func makeSyncPlan(local []*circleci.ProjectVariable, remote []*circleci.ProjectVariable) *syncPlan {
+	plan := &syncPlan{
+		adds:    make([]*circleci.ProjectVariable, 0),
+		updates: make([]*circleci.ProjectVariable, 0),
+		removes: make([]*circleci.ProjectVariable, 0),
+	}
+	rmp := makeProjectVariableMap(remote)
+	lmp := makeProjectVariableMap(local)
+	for _, lv := range lmp {
+		if _, prs := rmp[lv.Name]; prs {
+			plan.updates = append(plan.updates, lv)
+		} else {
+			plan.adds = append(plan.adds, lv)
+		}
+	}
+	for _, rv := range remote {
+		if _, prs := lmp[rv.Name]; !prs {
+			plan.removes = append(plan.removes, rv)
+		}
+	}
+	sortVariables(plan.adds)
+	sortVariables(plan.updates)
+	sortVariables(plan.removes)
+	return plan
+}
+
+func dumpSyncPlan(w io.Writer, plan *syncPlan) {
+	dumpNames(w, "These variables will be added.", variableNames(plan.adds))
+	dumpNames(w, "These variables will be updated.", variableNames(plan.updates))
+	dumpNames(w, "These variables will be removed.", variableNames(plan.removes))
+}
+
+// SyncVariablesFromFile makes the project variables match a file or stdin exactly
+// Variables not found in the input are removed from the project
+// If the path is empty, stdin will be used as input
+func (c *Client) SyncVariablesFromFile(ctx context.Context, path string, filetype string) ([]*ResultRecord, error) {
+	pvs, err := readVariables(c.ui, c.opts.AgeKeyFile, path, filetype)
+	if err != nil {
+		return nil, fmt.Errorf("sync vars: %w", err)
+	}
+	vs, err := c.listAllVariables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("sync vars: %w", err)
+	}
+
+	plan := makeSyncPlan(pvs, vs)
+	skipped := make([]*ResultRecord, 0)
+	if c.opts.NoOverwrite && len(plan.updates) > 0 {
+		dumpNames(c.info(), "These variables already exist and are skipped.", variableNames(plan.updates))
+		for _, v := range plan.updates {
+			skipped = append(skipped, &ResultRecord{Name: v.Name, Operation: "create", Result: ResultSkipped})
+		}
+		plan.updates = nil
+	}
+	if plan.empty() {
+		c.println("There are no changes.")
+		return skipped, nil
+	}
+	dumpSyncPlan(c.info(), plan)
+
+	yes, err := c.ui.YesNo("Do you want to apply these changes?")
+	if err != nil {
+		return nil, fmt.Errorf("sync vars: %w", err)
+	}
+	if !yes {
+		c.println("Cancelled.")
+		return nil, ErrCancelled
+	}
+
+	rs := c.createVariables(ctx, append(plan.adds, plan.updates...))
+	rs = append(rs, c.removeVariables(ctx, plan.removes)...)
+	rs = append(rs, skipped...)
+	return rs, checkResults(rs)
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	mock_cli "github.com/threepipes/circleci-env/mock/cli"
+)
+
+func Test_makeSyncPlan(t *testing.T) {
+	local := []*circleci.ProjectVariable{
+		{Name: "TEST_ENV_2", Value: "bbb"},
+		{Name: "TEST_ENV_1", Value: "aaa"},
+	}
+	remote := []*circleci.ProjectVariable{
+		{Name: "TEST_ENV_0", Value: "xxxx_abc"},
+		{Name: "TEST_ENV_2", Value: "xxxx_def"},
+	}
+	got := makeSyncPlan(local, remote)
+	assert.Equal(t, []*circleci.ProjectVariable{{Name: "TEST_ENV_1", Value: "aaa"}}, got.adds)
+	assert.Equal(t, []*circleci.ProjectVariable{{Name: "TEST_ENV_2", Value: "bbb"}}, got.updates)
+	assert.Equal(t, []*circleci.ProjectVariable{{Name: "TEST_ENV_0", Value: "xxxx_abc"}}, got.removes)
+	assert.False(t, got.empty())
+
+	assert.True(t, makeSyncPlan(nil, nil).empty())
+}
+
+func TestClient_SyncVariablesFromFile(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	expectedListURL := apiBaseURL + "/envvar"
+	expectedCreateURL := apiBaseURL + "/envvar"
+	expectedDeleteURL := apiBaseURL + "/envvar/TEST_ENV_0"
+
+	pvl := circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "TEST_ENV_0", Value: "xxxx_abc"},
+			{Name: "TEST_ENV_2", Value: "xxxx_def"},
+		},
+	}
+	listResp, err := httpmock.NewJsonResponder(200, pvl)
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", expectedListURL, listResp)
+	createResp, err := httpmock.NewJsonResponder(201, circleci.ProjectVariable{Name: "TEST_ENV", Value: "xxxxTEST"})
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("POST", expectedCreateURL, createResp)
+	httpmock.RegisterResponder("DELETE", expectedDeleteURL,
+		httpmock.NewStringResponder(200, `{"message":"OK"}`))
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	ui := mock_cli.NewMockUI(ctrl)
+	ui.EXPECT().YesNo(gomock.Any()).Return(true, nil)
+
+	c := &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		ui:          ui,
+		token:       testAPIToken,
+	}
+	if _, err := c.SyncVariablesFromFile(context.Background(), "fixtures/dotenv.test", "dotenv"); err != nil {
+		t.Error(err)
+	}
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["GET "+expectedListURL], "Expected number of list API call is wrong")
+	assert.Equal(t, 2, info["POST "+expectedCreateURL], "Expected number of post API call is wrong")
+	assert.Equal(t, 1, info["DELETE "+expectedDeleteURL], "Expected number of delete API call is wrong")
+}
+
+func TestClient_SyncVariablesFromFile_dryRun(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	expectedListURL := apiBaseURL + "/envvar"
+	pvl := circleci.ProjectVariableList{
+		Items: []*circleci.ProjectVariable{
+			{Name: "TEST_ENV_0", Value: "xxxx_abc"},
+			{Name: "TEST_ENV_2", Value: "xxxx_def"},
+		},
+	}
+	listResp, err := httpmock.NewJsonResponder(200, pvl)
+	if err != nil {
+		t.Error(err)
+	}
+	httpmock.RegisterResponder("GET", expectedListURL, listResp)
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	c := &Client{
+		ci:          ci,
+		projectSlug: projectSlug,
+		ui:          newUI(Options{DryRun: true}),
+		opts:        Options{DryRun: true},
+		token:       testAPIToken,
+	}
+	rs, err := c.SyncVariablesFromFile(context.Background(), "fixtures/dotenv.test", "dotenv")
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Len(t, rs, 3)
+	for _, r := range rs {
+		assert.Equal(t, ResultPlanned, r.Result, r.Name)
+	}
+	assert.Equal(t, "delete", rs[2].Operation)
+	assert.Equal(t, "TEST_ENV_0", rs[2].Name)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount(), "Only the list API should be called")
+}
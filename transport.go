@@ -0,0 +1,281 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grezar/go-circleci"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHost = "https://circleci.com"
+	apiV2URL    = defaultHost + "/api/v2"
+)
+
+func (c *Config) host() string {
+	if c.Host == "" {
+		return defaultHost
+	}
+	return strings.TrimSuffix(c.Host, "/")
+}
+
+// apiURL returns the base URL of the API v2
+func (c *Config) apiURL() string {
+	return c.host() + "/api/v2"
+}
+
+// apiV1URL returns the base URL of the API v1.1, which is used only for the APIs missing in v2
+func (c *Config) apiV1URL() string {
+	return c.host() + "/api/v1.1"
+}
+
+// DefaultMaxAttempts is the number of attempts of an API call used if Options.MaxAttempts is not set
+const DefaultMaxAttempts = 3
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// maxRetryAfter is the longest Retry-After to wait. The response is returned as it is if the server requests longer.
+	maxRetryAfter = time.Minute
+)
+
+// retryTransport retries requests on 429 and 5xx responses, and idempotent ones on network errors
+// It waits with exponential backoff and full jitter, or for Retry-After if the response has it.
+// On 429, the other requests sent concurrently through the same transport also wait for the delay.
+type retryTransport struct {
+	// base sends the requests. http.DefaultTransport is used if it is nil.
+	base        http.RoundTripper
+	maxAttempts int
+	// sleep waits for d unless ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+	// now returns the current time
+	now func() time.Time
+
+	mu sync.Mutex
+	// pausedUntil is the time until which no requests are sent because of rate limiting
+	pausedUntil time.Time
+}
+
+// pause holds the requests for d
+func (t *retryTransport) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := t.now().Add(d); until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
+
+// waitPause waits until the pause by rate limiting ends
+func (t *retryTransport) waitPause(ctx context.Context) error {
+	t.mu.Lock()
+	d := t.pausedUntil.Sub(t.now())
+	t.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	return t.sleep(ctx, d)
+}
+
+func newRetryTransport(base http.RoundTripper, maxAttempts int) *retryTransport {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &retryTransport{
+		base:        base,
+		maxAttempts: maxAttempts,
+		sleep:       sleepContext,
+		now:         time.Now,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// idempotent reports whether req can be sent again after a network error, when the first attempt may have been processed
+// POST of project variables is included since it replaces the variable of the same name.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/"), "/envvar")
+	}
+	return false
+}
+
+func shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		return idempotent(req)
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// retryAfter parses Retry-After in seconds or an HTTP date
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// backoff returns the delay before the next attempt after the attempt-th one (1-origin)
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 16 {
+		if exp := retryBaseDelay << (attempt - 1); exp < d {
+			d = exp
+		}
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// A request whose body cannot be read again is sent only once
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if err := t.waitPause(req.Context()); err != nil {
+			return nil, err
+		}
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+		res, err := base.RoundTrip(r)
+		if attempt >= t.maxAttempts || !replayable || !shouldRetry(req, res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+
+		delay, ok := retryAfter(res)
+		if ok && delay > maxRetryAfter {
+			return res, err
+		}
+		if !ok {
+			delay = backoff(attempt)
+		}
+		if res != nil && res.StatusCode == http.StatusTooManyRequests {
+			// The rate limit is shared by the concurrent requests
+			t.pause(delay)
+			delay = 0
+		}
+		if res != nil {
+			// Drain the body so that the connection can be reused
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		logrus.WithFields(logrus.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt,
+			"delay":   delay,
+		}).Debug("Retrying the request")
+		if delay > 0 {
+			if err := t.sleep(req.Context(), delay); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// newHTTPClient returns the HTTP client for the CA certificates and the proxy of cfg
+// Failed requests are retried up to maxAttempts times in total. DefaultMaxAttempts is used if it is not positive.
+func newHTTPClient(cfg *Config, maxAttempts int) (*http.Client, error) {
+	if cfg.CACert == "" && cfg.Proxy == "" {
+		// The default transport is looked up on each request
+		return &http.Client{Transport: newRetryTransport(nil, maxAttempts)}, nil
+	}
+	dt, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("new http client: the default transport is replaced")
+	}
+	t := dt.Clone()
+	if cfg.Proxy != "" {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("new http client: invalid proxy: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("new http client: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("new http client: no certificates found in %s", cfg.CACert)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: newRetryTransport(t, maxAttempts)}, nil
+}
+
+// newCircleCIClient returns the go-circleci client and the HTTP client for raw requests for cfg
+// Both of them share the same HTTP client
+func newCircleCIClient(cfg *Config, maxAttempts int) (*circleci.Client, *http.Client, error) {
+	hc, err := newHTTPClient(cfg, maxAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(cfg.host())
+	if err != nil {
+		return nil, nil, fmt.Errorf("new circleci client: invalid host: %w", err)
+	}
+	config := circleci.DefaultConfig()
+	config.Token = cfg.ApiToken
+	config.Address = cfg.host()
+	// go-circleci replaces the path of Address with BasePath, so the path prefix of the host (e.g. https://example.com/circleci) is kept here
+	config.BasePath = u.Path + "/api/v2/"
+	config.HTTPClient = hc
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ci, hc, nil
+}
@@ -0,0 +1,336 @@
+package cli
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_apiURL(t *testing.T) {
+	assert.Equal(t, "https://circleci.com/api/v2", (&Config{}).apiURL())
+	assert.Equal(t, "https://circleci.example.com/api/v2", (&Config{Host: "https://circleci.example.com/"}).apiURL())
+	assert.Equal(t, "https://circleci.example.com/api/v1.1", (&Config{Host: "https://circleci.example.com"}).apiV1URL())
+}
+
+func Test_newHTTPClient(t *testing.T) {
+	hc, err := newHTTPClient(&Config{}, 0)
+	if assert.NoError(t, err) {
+		rt := hc.Transport.(*retryTransport)
+		assert.Nil(t, rt.base, "the default transport is used")
+		assert.Equal(t, DefaultMaxAttempts, rt.maxAttempts)
+	}
+
+	hc, err = newHTTPClient(&Config{Proxy: "http://proxy.example.com:8080"}, 5)
+	if assert.NoError(t, err) {
+		rt := hc.Transport.(*retryTransport)
+		assert.Equal(t, 5, rt.maxAttempts)
+		req, _ := http.NewRequest("GET", "https://circleci.example.com", nil)
+		u, err := rt.base.(*http.Transport).Proxy(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "proxy.example.com:8080", u.Host)
+	}
+
+	_, err = newHTTPClient(&Config{CACert: filepath.Join(t.TempDir(), "notfound.pem")}, 0)
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = newHTTPClient(&Config{CACert: empty}, 0)
+	assert.Error(t, err)
+}
+
+func TestNewClient_CircleCIServer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Circle-Token") != testAPIToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v2/project/gh/org/repo":
+			w.Write([]byte(`{"slug":"gh/org/repo"}`))
+		case "/api/v2/project/gh/org/repo/envvar":
+			w.Write([]byte(`{"items":[{"name":"FOO","value":"xxxxfoo1"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	// The certificate of the test server is trusted only by CACert
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caPath, pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewClient(&Config{ApiToken: testAPIToken, Host: srv.URL, CACert: caPath}, "gh/org/repo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both the raw requests and go-circleci use the settings
+	got, err := c.ShowProject(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"slug": "gh/org/repo"}, got)
+	}
+	vs, err := c.ListVariables(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*VariableRecord{{Name: "FOO", Value: "xxxxfoo1"}}, vs)
+	}
+
+	c, err = NewClient(&Config{ApiToken: testAPIToken, Host: srv.URL}, "gh/org/repo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.ShowProject(context.Background())
+	assert.Error(t, err, "the certificate is not trusted without CACert")
+}
+
+func TestNewClient_hostWithPath(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/circleci/api/v2/project/gh/org/repo":
+			w.Write([]byte(`{"slug":"gh/org/repo"}`))
+		case "/circleci/api/v2/project/gh/org/repo/envvar":
+			w.Write([]byte(`{"items":[{"name":"FOO","value":"xxxxfoo1"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{ApiToken: testAPIToken, Host: srv.URL + "/circleci/"}, "gh/org/repo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both the raw requests and go-circleci keep the path prefix
+	_, err = c.ShowProject(context.Background())
+	assert.NoError(t, err)
+	_, err = c.ListVariables(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/circleci/api/v2/project/gh/org/repo", "/circleci/api/v2/project/gh/org/repo/envvar"}, paths)
+}
+
+// retryTestTransport returns a retryTransport whose sleeps are recorded instead of waiting
+func retryTestTransport(maxAttempts int) (*retryTransport, *[]time.Duration) {
+	var sleeps []time.Duration
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rt := newRetryTransport(nil, maxAttempts)
+	rt.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+	rt.now = func() time.Time { return now }
+	return rt, &sleeps
+}
+
+func TestRetryTransport(t *testing.T) {
+	const u = "https://circleci.com/api/v2/project/gh/org/repo/envvar"
+	retryAfter := func(v string, status int) httpmock.Responder {
+		res := httpmock.NewStringResponse(status, `{"message":"retry"}`)
+		res.Header.Set("Retry-After", v)
+		return httpmock.ResponderFromResponse(res)
+	}
+	tests := []struct {
+		name        string
+		maxAttempts int
+		responses   []httpmock.Responder
+		wantStatus  int
+		wantCalls   int
+		wantSleeps  []time.Duration
+	}{
+		{
+			name:        "retry on 5xx",
+			maxAttempts: 3,
+			responses: []httpmock.Responder{
+				httpmock.NewStringResponder(503, "unavailable"),
+				httpmock.NewStringResponder(502, "bad gateway"),
+				httpmock.NewStringResponder(200, "{}"),
+			},
+			wantStatus: 200,
+			wantCalls:  3,
+		},
+		{
+			name:        "honor Retry-After",
+			maxAttempts: 3,
+			responses: []httpmock.Responder{
+				retryAfter("2", 429),
+				httpmock.NewStringResponder(200, "{}"),
+			},
+			wantStatus: 200,
+			wantCalls:  2,
+			wantSleeps: []time.Duration{2 * time.Second},
+		},
+		{
+			name:        "too long Retry-After",
+			maxAttempts: 3,
+			responses:   []httpmock.Responder{retryAfter("3600", 429)},
+			wantStatus:  429,
+			wantCalls:   1,
+			wantSleeps:  []time.Duration{},
+		},
+		{
+			name:        "give up after max attempts",
+			maxAttempts: 2,
+			responses: []httpmock.Responder{
+				httpmock.NewStringResponder(500, "error"),
+				httpmock.NewStringResponder(500, "error"),
+				httpmock.NewStringResponder(200, "{}"),
+			},
+			wantStatus: 500,
+			wantCalls:  2,
+		},
+		{
+			name:        "no retry on 4xx",
+			maxAttempts: 3,
+			responses:   []httpmock.Responder{httpmock.NewStringResponder(404, "not found")},
+			wantStatus:  404,
+			wantCalls:   1,
+			wantSleeps:  []time.Duration{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			var bodies []string
+			i := 0
+			httpmock.RegisterResponder("POST", u, func(req *http.Request) (*http.Response, error) {
+				bt, _ := io.ReadAll(req.Body)
+				bodies = append(bodies, string(bt))
+				r := tt.responses[i]
+				i++
+				return r(req)
+			})
+
+			rt, sleeps := retryTestTransport(tt.maxAttempts)
+			hc := &http.Client{Transport: rt}
+			res, err := hc.Post(u, "application/json", strings.NewReader(`{"name":"FOO"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, tt.wantCalls, httpmock.GetTotalCallCount())
+			for _, b := range bodies {
+				assert.Equal(t, `{"name":"FOO"}`, b, "the body is sent again on retries")
+			}
+			if tt.wantSleeps != nil {
+				assert.Equal(t, tt.wantSleeps, append([]time.Duration{}, *sleeps...))
+			} else {
+				assert.Len(t, *sleeps, tt.wantCalls-1)
+				for _, d := range *sleeps {
+					assert.LessOrEqual(t, d, retryMaxDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransport_networkError(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		wantCalls int
+	}{
+		{"idempotent", "DELETE", "https://circleci.com/api/v2/project/gh/org/repo/envvar/FOO", 2},
+		{"upsert of project variables", "POST", "https://circleci.com/api/v2/project/gh/org/repo/envvar", 2},
+		{"creation of a restriction", "POST", "https://circleci.com/api/v2/context/ctx-id/restrictions", 1},
+		{"creation of a context", "POST", "https://circleci.com/api/v2/context", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder(tt.method, tt.url, httpmock.NewErrorResponder(errors.New("connection reset by peer")))
+
+			rt, _ := retryTestTransport(2)
+			hc := &http.Client{Transport: rt}
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(`{"name":"FOO"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = hc.Do(req)
+			assert.Error(t, err)
+			assert.Equal(t, tt.wantCalls, httpmock.GetTotalCallCount())
+		})
+	}
+}
+
+func TestNewClient_retry(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// go-circleci and the raw requests share the retrying client
+	res := httpmock.NewStringResponse(429, `{"message":"rate limited"}`)
+	res.Header.Set("Retry-After", "0")
+	httpmock.RegisterResponder("GET", apiBaseURL+"/envvar", httpmock.ResponderFromMultipleResponses([]*http.Response{
+		res,
+		httpmock.NewStringResponse(200, `{"items":[{"name":"FOO","value":"xxxxfoo1"}]}`),
+	}))
+	httpmock.RegisterResponder("GET", apiBaseURL, httpmock.ResponderFromMultipleResponses([]*http.Response{
+		httpmock.NewStringResponse(503, "unavailable"),
+		httpmock.NewStringResponse(200, `{"slug":"gh/org/repo"}`),
+	}))
+
+	c, err := NewClient(&Config{ApiToken: testAPIToken}, projectSlug, Options{MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.httpClient.Transport.(*retryTransport).sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+	vs, err := c.ListVariables(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*VariableRecord{{Name: "FOO", Value: "xxxxfoo1"}}, vs)
+	}
+	_, err = c.ShowProject(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestRetryTransport_sharedPause(t *testing.T) {
+	const u = "https://circleci.com/api/v2/project/gh/org/repo/envvar"
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	limited := httpmock.NewStringResponse(429, `{"message":"rate limited"}`)
+	limited.Header.Set("Retry-After", "5")
+	httpmock.RegisterResponder("GET", u+"/FOO", httpmock.ResponderFromResponse(limited))
+	httpmock.RegisterResponder("GET", u+"/BAR", httpmock.NewStringResponder(200, "{}"))
+
+	rt, sleeps := retryTestTransport(2)
+	hc := &http.Client{Transport: rt}
+	res, err := hc.Get(u + "/FOO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	assert.Equal(t, []time.Duration{5 * time.Second}, *sleeps)
+
+	// Another request waits for the rest of the pause before it is sent
+	rt.pausedUntil = rt.now().Add(3 * time.Second)
+	res, err = hc.Get(u + "/BAR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, []time.Duration{5 * time.Second, 3 * time.Second}, *sleeps)
+}
@@ -3,12 +3,17 @@ package cli
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/AlecAivazis/survey/v2"
 )
 
 type Prompt struct {
+	// Messages receives the message of ReadAll. If nil, it is discarded.
+	Messages io.Writer
+	// EchoInput writes the input read by ReadAll back to Messages
+	EchoInput bool
 }
 
 var _ UI = &Prompt{}
@@ -63,7 +68,11 @@ func (p *Prompt) ReadLine(msg string) (string, error) {
 }
 
 func (p *Prompt) ReadAll(msg string) (string, error) {
-	fmt.Println(msg)
+	w := p.Messages
+	if w == nil {
+		w = io.Discard
+	}
+	fmt.Fprintln(w, msg)
 	scn := bufio.NewScanner(os.Stdin)
 	ans := ""
 	for scn.Scan() {
@@ -72,6 +81,34 @@ func (p *Prompt) ReadAll(msg string) (string, error) {
 	if err := scn.Err(); err != nil {
 		return "", fmt.Errorf("read input without tty: %w", err)
 	}
-	fmt.Println(ans)
+	if p.EchoInput {
+		fmt.Fprintln(w, ans)
+	}
 	return ans, nil
 }
+
+// AssumeYes answers yes to all the confirmations without prompts
+// The other inputs are delegated to the embedded UI
+type AssumeYes struct {
+	UI
+	// Messages receives the assumed answers. If nil, they are discarded.
+	Messages io.Writer
+}
+
+var _ UI = &AssumeYes{}
+
+func (a *AssumeYes) YesNo(msg string) (bool, error) {
+	if a.Messages != nil {
+		fmt.Fprintf(a.Messages, "%s Yes (assumed)\n", msg)
+	}
+	return true, nil
+}
+
+func newUI(opts Options) UI {
+	p := &Prompt{Messages: opts.Messages, EchoInput: opts.EchoInput}
+	// Nothing is changed in dry run, so the confirmations are not needed
+	if opts.AssumeYes || opts.DryRun {
+		return &AssumeYes{UI: p, Messages: opts.Messages}
+	}
+	return p
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grezar/go-circleci"
+)
+
+// UserRecord is the user who owns an API token
+type UserRecord struct {
+	ID    string `json:"id" yaml:"id"`
+	Login string `json:"login" yaml:"login"`
+	Name  string `json:"name" yaml:"name"`
+}
+
+// CurrentUser returns the owner of the API token in cfg
+// It can be used to confirm that the token is valid
+func CurrentUser(ctx context.Context, cfg *Config, opts Options) (*UserRecord, error) {
+	ci, _, err := newCircleCIClient(cfg, opts.MaxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("current user: %w", err)
+	}
+	return currentUser(ctx, ci)
+}
+
+func currentUser(ctx context.Context, ci *circleci.Client) (*UserRecord, error) {
+	u, err := ci.Users.Me(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("current user: %w", err)
+	}
+	return &UserRecord{
+		ID:    u.ID,
+		Login: u.Login,
+		Name:  u.Name,
+	}, nil
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/grezar/go-circleci"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_currentUser(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	config := circleci.DefaultConfig()
+	config.HTTPClient = http.DefaultClient
+	config.Token = testAPIToken
+	ci, err := circleci.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v2/me",
+		httpmock.NewStringResponder(200, `{"id":"uid","login":"octocat","name":"The Octocat"}`))
+	got, err := currentUser(context.Background(), ci)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, &UserRecord{ID: "uid", Login: "octocat", Name: "The Octocat"}, got)
+
+	httpmock.RegisterResponder("GET", "https://circleci.com/api/v2/me",
+		httpmock.NewStringResponder(401, `{"message":"You must log in first."}`))
+	_, err = currentUser(context.Background(), ci)
+	assert.ErrorIs(t, err, circleci.ErrUnauthorized)
+}